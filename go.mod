@@ -15,4 +15,6 @@ require (
 	github.com/spf13/viper v1.6.3
 	github.com/tcnksm/go-gitconfig v0.1.2
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	golang.org/x/sys v0.0.0-20191120155948-bd437916bb0e
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const olderThanFlag = "older-than"
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "manage the cache of Git repositories",
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the repositories in the cache",
+	RunE:  cacheListAction,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "remove the repositories in the cache that have not been used recently",
+	RunE:  cachePruneAction,
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "remove all the repositories in the cache",
+	RunE:  cacheCleanAction,
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheCleanCmd)
+
+	cacheCmd.PersistentFlags().String(cacheDirFlag, "~/.promotion/cache", "where Git checkouts are cached")
+	cacheCmd.PersistentFlags().Duration(lockTimeoutFlag, git.DefaultLockTimeout, "how long to wait for promotions using the cache to release a repository")
+
+	cachePruneCmd.Flags().String(olderThanFlag, "7d", "remove the repositories that have not been used for this long, e.g. 7d or 12h")
+}
+
+func cacheListAction(c *cobra.Command, args []string) error {
+	cache, err := newCache(c)
+	if err != nil {
+		return err
+	}
+	entries, err := cache.Entries()
+	if err != nil {
+		return fmt.Errorf("failed to list the cache: %w", err)
+	}
+	w := tabwriter.NewWriter(c.OutOrStdout(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tKIND\tBRANCHES\tSIZE\tLAST USED")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.URL, e.Kind, strings.Join(e.Branches, ","), formatSize(e.Size), e.LastUsed.Local().Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
+
+func cachePruneAction(c *cobra.Command, args []string) error {
+	bindFlags(c.Flags(), []string{olderThanFlag})
+	olderThan, err := parseAge(viper.GetString(olderThanFlag))
+	if err != nil {
+		return err
+	}
+	cache, err := newCache(c)
+	if err != nil {
+		return err
+	}
+	removed, err := cache.Prune(time.Now().Add(-olderThan))
+	for _, e := range removed {
+		fmt.Fprintf(c.OutOrStdout(), "removed %s %s (%s)\n", e.Kind, e.URL, formatSize(e.Size))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to prune the cache: %w", err)
+	}
+	return nil
+}
+
+func cacheCleanAction(c *cobra.Command, args []string) error {
+	cache, err := newCache(c)
+	if err != nil {
+		return err
+	}
+	if err := cache.Clean(); err != nil {
+		return fmt.Errorf("failed to clean the cache: %w", err)
+	}
+	fmt.Fprintf(c.OutOrStdout(), "cleaned %s\n", cache.Dir)
+	return nil
+}
+
+func newCache(c *cobra.Command) (*git.Cache, error) {
+	bindFlags(c.Flags(), []string{
+		cacheDirFlag,
+		lockTimeoutFlag,
+	})
+	cacheDir, err := homedir.Expand(viper.GetString(cacheDirFlag))
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand cacheDir path: %w", err)
+	}
+	if _, err := os.Stat(cacheDir); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &git.Cache{Dir: cacheDir, LockTimeout: viper.GetDuration(lockTimeoutFlag)}, nil
+}
+
+// parseAge parses a duration, which can also be a number of days, e.g. 7d.
+func parseAge(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q, must be a number of days e.g. 7d, or a duration e.g. 12h", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q, must be a number of days e.g. 7d, or a duration e.g. 12h", s)
+	}
+	return d, nil
+}
+
+// formatSize formats a number of bytes in binary units, e.g. 1.5MiB.
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
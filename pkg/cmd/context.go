@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/viper"
+)
+
+// newSignalContext returns a context that's cancelled on SIGINT or SIGTERM, so
+// that a promotion can stop cleanly, and clean up the cache. A second signal
+// isn't caught, and stops the process immediately.
+//
+// The returned func stops listening for the signals.
+func newSignalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			if logger, err := newLogger(); err == nil {
+				logger.Warn("stopping after signal", "signal", sig.String())
+			}
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// withTimeout returns a context that's cancelled when the --timeout expires,
+// if there is one.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := viper.GetDuration(timeoutFlag); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/rhd-gitops-example/services/pkg/promotion"
+	"github.com/spf13/cobra"
+)
+
+// The exit codes for the kinds of failure, so that pipelines can tell them
+// apart, these are documented in the README.
+const (
+	exitFailure        = 1
+	exitUsage          = 2
+	exitAuth           = 3
+	exitNotFound       = 4
+	exitNoChanges      = 5
+	exitConflict       = 6
+	exitRemoteRejected = 7
+	exitValidation     = 8
+)
+
+var exitCodes = []struct {
+	kind error
+	code int
+}{
+	{errUsage, exitUsage},
+	{promotion.ErrAuth, exitAuth},
+	{promotion.ErrNotFound, exitNotFound},
+	{promotion.ErrNoChanges, exitNoChanges},
+	{promotion.ErrConflict, exitConflict},
+	{promotion.ErrRemoteRejected, exitRemoteRejected},
+	{promotion.ErrValidation, exitValidation},
+}
+
+// errUsage is an invalid command line, e.g. an unknown flag.
+var errUsage = errors.New("invalid usage")
+
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Is(target error) bool {
+	return target == errUsage
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+func flagError(c *cobra.Command, err error) error {
+	return usageError{err: err}
+}
+
+// commandLineErrors are the start of the messages of the errors cobra returns
+// for invalid command lines, other than the flag errors that are passed to the
+// FlagErrorFunc.
+var commandLineErrors = []string{
+	"required flag(s) ", "unknown command ", "invalid argument ",
+	"requires at least ", "accepts at most ", "accepts between ",
+}
+
+// commandLineError returns a usageError if the error is cobra's error for an
+// invalid command line, otherwise the error is returned.
+func commandLineError(err error) error {
+	if err == nil || errors.Is(err, errUsage) {
+		return err
+	}
+	for _, prefix := range commandLineErrors {
+		if strings.HasPrefix(err.Error(), prefix) {
+			return usageError{err: err}
+		}
+	}
+	return err
+}
+
+// exitCode returns the exit code for the error.
+func exitCode(err error) int {
+	for _, e := range exitCodes {
+		if errors.Is(err, e.kind) {
+			return e.code
+		}
+	}
+	return exitFailure
+}
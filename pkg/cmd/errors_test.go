@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/promotion"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("unknown failure"), exitFailure},
+		{usageError{err: errors.New("unknown flag: --unknown")}, exitUsage},
+		{commandLineError(errors.New(`required flag(s) "from", "to" not set`)), exitUsage},
+		{commandLineError(errors.New(`unknown command "promot" for "services"`)), exitUsage},
+		{git.WrapGitError(&git.CommandError{Command: "push", Kind: git.ErrAuth, Err: errors.New("exit status 128")}, "failed to push", "https://github.com/testing/testing.git"), exitAuth},
+		{git.Errorf(promotion.ErrNotFound, "did not find environment folder matching %q", "test"), exitNotFound},
+		{fmt.Errorf("failed to commit: %w", &git.CommandError{Command: "commit", Kind: git.ErrNoChanges, Err: errors.New("exit status 1")}), exitNoChanges},
+		{fmt.Errorf("failed to push: %w", &git.CommandError{Command: "push", Kind: git.ErrConflict, Err: errors.New("exit status 1")}), exitConflict},
+		{fmt.Errorf("failed to push: %w", &git.CommandError{Command: "push", Kind: git.ErrRemoteRejected, Err: errors.New("exit status 1")}), exitRemoteRejected},
+		{git.Errorf(promotion.ErrValidation, "source repository failed validation: %w", errors.New("invalid YAML")), exitValidation},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%q) got %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/rhd-gitops-example/services/pkg/logging"
+	"github.com/spf13/viper"
+)
+
+// secrets are the access tokens that are redacted from the logs, tokens are
+// added as they're found.
+var secrets = &logging.Secrets{}
+
+// newLogger returns a logger that writes to stderr in the --log-format, at the
+// --log-level, or the debug level if --debug is set.
+func newLogger() (logging.Logger, error) {
+	format, err := logging.ParseFormat(viper.GetString(logFormatFlag))
+	if err != nil {
+		return nil, err
+	}
+	level, err := logging.ParseLevel(viper.GetString(logLevelFlag))
+	if err != nil {
+		return nil, err
+	}
+	if viper.GetBool(debugFlag) {
+		level = logging.LevelDebug
+	}
+	return logging.New(os.Stderr, format, level, secrets), nil
+}
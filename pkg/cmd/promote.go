@@ -3,10 +3,13 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/local"
 	"github.com/rhd-gitops-example/services/pkg/promotion"
+	"github.com/rhd-gitops-example/services/pkg/retry"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/tcnksm/go-gitconfig"
@@ -23,26 +26,55 @@ const (
 	fromFlag          = "from"
 	fromBranchFlag    = "from-branch"
 	fromEnvFolderFlag = "from-env-folder"
+	fromPathFlag      = "from-path"
+	fromRefFlag       = "from-ref"
 	serviceFlag       = "service"
 	toFlag            = "to"
 	toBranchFlag      = "to-branch"
 	toEnvFolderFlag   = "to-env-folder"
+	strategyFlag      = "strategy"
+	helmValuesFlag    = "helm-values"
+	includeFlag       = "include"
+	excludeFlag       = "exclude"
+	validateFlag      = "validate"
+	schemaDirFlag     = "schema-dir"
 
 	repoFlag = "repo" // used by subcommands
 )
 
+// Flags for rendering templated files from a local service.
+const (
+	setFlag             = "set"
+	valuesFlag          = "values"
+	imageDigestFileFlag = "image-digest-file"
+	renderFlag          = "render"
+)
+
 func init() {
 	rootCmd.AddCommand(promoteCmd)
 
 	promoteCmd.PersistentFlags().String(branchNameFlag, "", "the branch on the destination repository for the pull request (auto-generated if empty)")
 	promoteCmd.PersistentFlags().String(cacheDirFlag, "~/.promotion/cache", "where to cache Git checkouts")
 	promoteCmd.PersistentFlags().Bool(keepCacheFlag, false, "whether to retain the locally cloned repositories in the cache directory")
+	promoteCmd.PersistentFlags().Duration(lockTimeoutFlag, git.DefaultLockTimeout, "how long to wait for other promotions sharing the cache to release a repository")
+	promoteCmd.PersistentFlags().String(strategyFlag, promotion.DefaultStrategy, fmt.Sprintf("how the service's configuration is promoted, one of: %s", strings.Join(promotion.Strategies(), ", ")))
+	promoteCmd.PersistentFlags().StringSlice(helmValuesFlag, git.DefaultHelmValues, "the keys in values.yaml that are promoted by the helm strategy")
+	promoteCmd.PersistentFlags().StringSlice(includeFlag, nil, "only promote the service's files that match these glob patterns")
+	promoteCmd.PersistentFlags().StringSlice(excludeFlag, nil, "don't promote the service's files that match these glob patterns")
+	promoteCmd.PersistentFlags().String(validateFlag, "off", "validate promoted files against Kubernetes schemas before committing: strict, warn or off")
+	promoteCmd.PersistentFlags().String(schemaDirFlag, "", "a directory of CustomResourceDefinitions to validate custom resources against")
 
 	promoteCmd.Flags().String(fromFlag, "", "the source Git repository (URL or local)")
 	promoteCmd.Flags().String(toFlag, "", "the destination Git repository")
 	promoteCmd.Flags().String(serviceFlag, "", "the name of the service to promote")
 	promoteCmd.Flags().String(fromBranchFlag, "master", "the branch on the source Git repository")
+	promoteCmd.Flags().String(fromRefFlag, "", "a commit SHA or tag on the source branch to promote (the head of the branch if not provided)")
 	promoteCmd.Flags().String(fromEnvFolderFlag, "", "env folder on the source Git repository (if not provided, the repository should only have one folder under environments/)")
+	promoteCmd.Flags().StringSlice(fromPathFlag, []string{"config"}, "the folders to promote from a local service, a folder can be mapped to a folder in the destination with source:destination")
+	promoteCmd.Flags().StringArray(setFlag, nil, "a key=value to use when rendering templated files from a local service, can be repeated")
+	promoteCmd.Flags().StringSlice(valuesFlag, nil, "YAML files with values to use when rendering templated files from a local service")
+	promoteCmd.Flags().String(imageDigestFileFlag, "", "a file containing the digest of the built image, e.g. a Tekton result, to use when rendering templated files from a local service")
+	promoteCmd.Flags().String(renderFlag, string(local.RenderTemplates), "how a local service is rendered before it's promoted: templates or kustomize")
 	promoteCmd.Flags().String(toBranchFlag, "master", "the branch on the destination Git repository")
 	promoteCmd.Flags().String(toEnvFolderFlag, "", "env folder on the destination Git repository (if not provided, the repository should only have one folder under environments/)")
 
@@ -56,13 +88,26 @@ func promoteAction(c *cobra.Command, args []string) error {
 		branchNameFlag,
 		cacheDirFlag,
 		keepCacheFlag,
+		lockTimeoutFlag,
+		strategyFlag,
+		helmValuesFlag,
+		includeFlag,
+		excludeFlag,
+		validateFlag,
+		schemaDirFlag,
 	})
 	bindFlags(c.Flags(), []string{
 		fromFlag,
 		toFlag,
 		serviceFlag,
 		fromBranchFlag,
+		fromRefFlag,
 		fromEnvFolderFlag,
+		fromPathFlag,
+		setFlag,
+		valuesFlag,
+		imageDigestFileFlag,
+		renderFlag,
 		toBranchFlag,
 		toEnvFolderFlag,
 	})
@@ -76,6 +121,7 @@ func promoteAction(c *cobra.Command, args []string) error {
 	newBranchName := viper.GetString(branchNameFlag)
 	msg := viper.GetString(msgFlag)
 	fromBranch := viper.GetString(fromBranchFlag)
+	fromRef := viper.GetString(fromRefFlag)
 	fromEnvFolder := viper.GetString(fromEnvFolderFlag)
 	keepCache := viper.GetBool(keepCacheFlag)
 	toBranch := viper.GetString(toBranchFlag)
@@ -85,6 +131,7 @@ func promoteAction(c *cobra.Command, args []string) error {
 		RepoPath: fromRepo,
 		Branch:   fromBranch,
 		Folder:   fromEnvFolder,
+		Ref:      fromRef,
 	}
 	to := promotion.EnvLocation{
 		RepoPath: toRepo,
@@ -92,38 +139,102 @@ func promoteAction(c *cobra.Command, args []string) error {
 		Folder:   toEnvFolder,
 	}
 
-	sm, err := newServiceManager()
+	sm, err := newServiceManager(c)
 	if err != nil {
 		return err
 	}
 
-	return sm.Promote(service, from, to, newBranchName, msg, keepCache)
+	ctx, cancel := withTimeout(c.Context())
+	defer cancel()
+	return sm.Promote(ctx, service, from, to, newBranchName, msg, keepCache)
+}
+
+func newServiceManager(c *cobra.Command) (*promotion.ServiceManager, error) {
+	author, err := newAuthor(c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to establish credentials: %w", err)
+	}
+	return newServiceManagerForAuthor(c, author)
 }
 
-func newServiceManager() (*promotion.ServiceManager, error) {
+func newServiceManagerForAuthor(c *cobra.Command, author *git.Author) (*promotion.ServiceManager, error) {
 	cacheDir, err := homedir.Expand(viper.GetString(cacheDirFlag))
 	if err != nil {
 		return nil, fmt.Errorf("failed to expand cacheDir path: %w", err)
 	}
 
-	author, err := newAuthor()
+	validationMode, err := promotion.ParseValidationMode(viper.GetString(validateFlag))
 	if err != nil {
-		return nil, fmt.Errorf("unable to establish credentials: %w", err)
+		return nil, err
+	}
+	schemaDir, err := homedir.Expand(viper.GetString(schemaDirFlag))
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand schemaDir path: %w", err)
+	}
+
+	localPaths, err := local.ParsePaths(viper.GetStringSlice(fromPathFlag))
+	if err != nil {
+		return nil, err
+	}
+
+	setValues, err := stringArrayFlag(c, setFlag)
+	if err != nil {
+		return nil, err
+	}
+	renderer, err := local.NewRenderer(viper.GetStringSlice(valuesFlag), setValues, viper.GetString(imageDigestFileFlag))
+	if err != nil {
+		return nil, err
+	}
+	renderer.Mode, err = local.ParseRenderMode(viper.GetString(renderFlag))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := newTokens()
+	if err != nil {
+		return nil, err
+	}
+	logger, err := newLogger()
+	if err != nil {
+		return nil, err
+	}
+	// The keys are only configured when they're given, so that a strategy
+	// registered as "helm" isn't replaced by one with the default keys.
+	var helmValues []string
+	if f := c.Flags().Lookup(helmValuesFlag); f != nil && f.Changed {
+		helmValues = viper.GetStringSlice(helmValuesFlag)
 	}
 
 	return promotion.New(
 		cacheDir,
 		author,
-		promotion.WithDebug(viper.GetBool(debugFlag)),
+		promotion.WithSchemaValidation(validationMode, schemaDir),
+		promotion.WithStrategy(viper.GetString(strategyFlag)),
+		promotion.WithHelmValues(helmValues),
+		promotion.WithLocalPaths(localPaths),
+		promotion.WithRenderer(renderer),
+		promotion.WithFilter(viper.GetStringSlice(includeFlag), viper.GetStringSlice(excludeFlag)),
+		promotion.WithLockTimeout(viper.GetDuration(lockTimeoutFlag)),
+		promotion.WithRetry(newRetryPolicy()),
+		promotion.WithTokens(tokens),
+		promotion.WithLogger(logger),
 		promotion.WithInsecureSkipVerify(viper.GetBool(insecureSkipVerifyFlag)),
 		promotion.WithRepoType(viper.GetString(repoTypeFlag)),
 	), nil
 }
 
-func newAuthor() (*git.Author, error) {
+// newRetryPolicy returns the policy for retrying transient failures, with the
+// number of retries and the initial delay from the flags.
+func newRetryPolicy() retry.Policy {
+	p := retry.DefaultPolicy
+	p.Attempts = viper.GetInt(retriesFlag) + 1
+	p.InitialDelay = viper.GetDuration(retryDelayFlag)
+	return p
+}
+
+func newAuthor(c *cobra.Command) (*git.Author, error) {
 	name := viper.GetString(nameFlag)
 	email := viper.GetString(emailFlag)
-	token := viper.GetString(githubTokenFlag)
 
 	var err error
 	if name == "" {
@@ -145,5 +256,47 @@ func newAuthor() (*git.Author, error) {
 		return nil, errors.New("unable to identify user and email for commits")
 	}
 
-	return &git.Author{Name: name, Email: email, Token: token}, nil
+	signKey := viper.GetString(signKeyFlag)
+	if strings.EqualFold(viper.GetString(signFormatFlag), git.SSHFormat) {
+		if signKey, err = homedir.Expand(signKey); err != nil {
+			return nil, fmt.Errorf("failed to expand the signing key path: %w", err)
+		}
+	}
+	signing, err := git.NewSigning(signKey, viper.GetString(signFormatFlag))
+	if err != nil {
+		return nil, err
+	}
+
+	committer, err := newCommitter()
+	if err != nil {
+		return nil, err
+	}
+
+	coAuthorValues, err := stringArrayFlag(c, coAuthorFlag)
+	if err != nil {
+		return nil, err
+	}
+	var coAuthors []git.Identity
+	for _, s := range coAuthorValues {
+		coAuthor, err := git.ParseIdentity(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", coAuthorFlag, err)
+		}
+		coAuthors = append(coAuthors, coAuthor)
+	}
+
+	return &git.Author{Name: name, Email: email, Committer: committer, CoAuthors: coAuthors, Signing: signing}, nil
+}
+
+// newCommitter returns the committer if it's different from the author.
+func newCommitter() (*git.Identity, error) {
+	name := viper.GetString(committerNameFlag)
+	email := viper.GetString(committerEmailFlag)
+	if name == "" && email == "" {
+		return nil, nil
+	}
+	if name == "" || email == "" {
+		return nil, fmt.Errorf("both --%s and --%s must be provided for the committer", committerNameFlag, committerEmailFlag)
+	}
+	return &git.Identity{Name: name, Email: email}, nil
 }
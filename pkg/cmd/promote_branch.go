@@ -56,7 +56,7 @@ func promoteBranchAction(c *cobra.Command, args []string) error {
 		Folder:   "",
 	}
 
-	sm, err := newServiceManager()
+	sm, err := newServiceManager(c)
 	if err != nil {
 		return err
 	}
@@ -65,5 +65,7 @@ func promoteBranchAction(c *cobra.Command, args []string) error {
 		msg = fmt.Sprintf("Promote branch %s to %s", fromBranch, toBranch)
 	}
 
-	return sm.Promote(service, from, to, newBranchName, msg, keepCache)
+	ctx, cancel := withTimeout(c.Context())
+	defer cancel()
+	return sm.Promote(ctx, service, from, to, newBranchName, msg, keepCache)
 }
@@ -56,7 +56,7 @@ func promoteEnvAction(c *cobra.Command, args []string) error {
 		Folder:   toEnvFolder,
 	}
 
-	sm, err := newServiceManager()
+	sm, err := newServiceManager(c)
 	if err != nil {
 		return err
 	}
@@ -65,5 +65,7 @@ func promoteEnvAction(c *cobra.Command, args []string) error {
 		msg = fmt.Sprintf("Promote environment %s to %s", fromEnvFolder, toEnvFolder)
 	}
 
-	return sm.Promote(service, from, to, newBranchName, msg, keepCache)
+	ctx, cancel := withTimeout(c.Context())
+	defer cancel()
+	return sm.Promote(ctx, service, from, to, newBranchName, msg, keepCache)
 }
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"github.com/rhd-gitops-example/services/pkg/promotion"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const imageFlag = "image"
+
+var promoteImageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "promote a container image reference into a repository",
+	RunE:  promoteImageAction,
+}
+
+func init() {
+	promoteCmd.AddCommand(promoteImageCmd)
+
+	promoteImageCmd.Flags().String(imageFlag, "", "the image reference to promote, with a tag or digest")
+	promoteImageCmd.Flags().String(toFlag, "", "the URL of the destination repository")
+	promoteImageCmd.Flags().String(serviceFlag, "", "the name of the service to promote")
+	promoteImageCmd.Flags().String(toBranchFlag, "master", "the branch on the destination Git repository")
+	promoteImageCmd.Flags().String(toEnvFolderFlag, "", "env folder on the destination Git repository (if not provided, the repository should only have one folder under environments/)")
+
+	logIfError(promoteImageCmd.MarkFlagRequired(imageFlag))
+	logIfError(promoteImageCmd.MarkFlagRequired(toFlag))
+	logIfError(promoteImageCmd.MarkFlagRequired(serviceFlag))
+}
+
+func promoteImageAction(c *cobra.Command, args []string) error {
+	bindFlags(c.Flags(), []string{
+		imageFlag,
+		toFlag,
+		serviceFlag,
+		toBranchFlag,
+		toEnvFolderFlag,
+	})
+
+	image := viper.GetString(imageFlag)
+	toRepo := viper.GetString(toFlag)
+	service := viper.GetString(serviceFlag)
+
+	newBranchName := viper.GetString(branchNameFlag)
+	msg := viper.GetString(msgFlag)
+	keepCache := viper.GetBool(keepCacheFlag)
+
+	to := promotion.EnvLocation{
+		RepoPath: toRepo,
+		Branch:   viper.GetString(toBranchFlag),
+		Folder:   viper.GetString(toEnvFolderFlag),
+	}
+
+	sm, err := newServiceManager(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(c.Context())
+	defer cancel()
+	return sm.PromoteImage(ctx, service, image, to, newBranchName, msg, keepCache)
+}
@@ -52,7 +52,7 @@ func promoteRepoAction(c *cobra.Command, args []string) error {
 		Folder:   "",
 	}
 
-	sm, err := newServiceManager()
+	sm, err := newServiceManager(c)
 	if err != nil {
 		return err
 	}
@@ -61,5 +61,7 @@ func promoteRepoAction(c *cobra.Command, args []string) error {
 		msg = fmt.Sprintf("Promote repository %s to %s", fromRepo, toRepo)
 	}
 
-	return sm.Promote(service, from, to, newBranchName, msg, keepCache)
+	ctx, cancel := withTimeout(c.Context())
+	defer cancel()
+	return sm.Promote(ctx, service, from, to, newBranchName, msg, keepCache)
 }
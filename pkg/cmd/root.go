@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"log"
+	"os"
 	"strings"
 
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/logging"
+	"github.com/rhd-gitops-example/services/pkg/retry"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -11,31 +15,66 @@ import (
 
 const (
 	cacheDirFlag           = "cache-dir"
+	coAuthorFlag           = "co-author"
+	committerEmailFlag     = "committer-email"
+	committerNameFlag      = "committer-name"
+	configFlag             = "config"
 	emailFlag              = "commit-email"
 	msgFlag                = "commit-message"
 	nameFlag               = "commit-name"
 	debugFlag              = "debug"
 	githubTokenFlag        = "github-token"
+	githubAppIDFlag        = "github-app-id"
+	githubAppInstallFlag   = "github-app-installation-id"
+	githubAppKeyFlag       = "github-app-private-key"
+	githubAppHostFlag      = "github-app-host"
 	insecureSkipVerifyFlag = "insecure-skip-verify"
 	keepCacheFlag          = "keep-cache"
+	lockTimeoutFlag        = "lock-timeout"
+	logFormatFlag          = "log-format"
+	logLevelFlag           = "log-level"
 	repoTypeFlag           = "repository-type"
+	retriesFlag            = "retries"
+	retryDelayFlag         = "retry-delay"
+	signKeyFlag            = "sign-key"
+	signFormatFlag         = "sign-format"
+	timeoutFlag            = "timeout"
+	tokenFileFlag          = "token-file"
 )
 
+// The errors, including invalid command lines, are logged by Execute, so that
+// they're redacted and in the --log-format.
 var rootCmd = &cobra.Command{
-	Use:   "services",
-	Short: "manage services lifecycle via GitOps",
+	Use:           "services",
+	Short:         "manage services lifecycle via GitOps",
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
 func init() {
 	rootCmd.PersistentFlags().String(emailFlag, "", "the email to use for commits when creating branches")
 	rootCmd.PersistentFlags().String(msgFlag, "", "the message to use on the resultant commit and pull request")
 	rootCmd.PersistentFlags().String(nameFlag, "", "the name to use for commits when creating branches")
-	rootCmd.PersistentFlags().Bool(debugFlag, false, "additional debug logging output")
+	rootCmd.PersistentFlags().String(committerNameFlag, "", "the name of the committer, if the commits are committed on behalf of the --commit-name")
+	rootCmd.PersistentFlags().String(committerEmailFlag, "", "the email of the committer, if the commits are committed on behalf of the --commit-email")
+	rootCmd.PersistentFlags().StringArray(coAuthorFlag, nil, "a \"Name <email>\" to credit in a Co-authored-by trailer, can be repeated")
+	rootCmd.PersistentFlags().String(signKeyFlag, "", "the GPG key ID, or the path to the SSH key, to sign commits with (commits are not signed if empty)")
+	rootCmd.PersistentFlags().String(signFormatFlag, git.GPGFormat, "the format of the --sign-key: gpg or ssh")
+	rootCmd.PersistentFlags().Bool(debugFlag, false, "additional debug logging output, the same as --log-level debug")
+	rootCmd.PersistentFlags().String(logFormatFlag, string(logging.FormatText), "the format of the log output: text or json")
+	rootCmd.PersistentFlags().String(logLevelFlag, logging.LevelInfo.String(), "the minimum level of messages that are logged: debug, info, warn or error")
 	rootCmd.PersistentFlags().String(githubTokenFlag, "", "oauth access token to authenticate the request")
+	rootCmd.PersistentFlags().Int64(githubAppIDFlag, 0, "the ID of a GitHub App to authenticate as, instead of an oauth access token")
+	rootCmd.PersistentFlags().Int64(githubAppInstallFlag, 0, "the ID of the GitHub App's installation for the repositories")
+	rootCmd.PersistentFlags().String(githubAppKeyFlag, "", "a file containing the GitHub App's private key")
+	rootCmd.PersistentFlags().String(githubAppHostFlag, "github.com", "the host the GitHub App is installed on, github.com or a GitHub Enterprise server")
+	rootCmd.PersistentFlags().String(tokenFileFlag, "", "a file containing the oauth access token, instead of --github-token")
+	rootCmd.PersistentFlags().String(configFlag, "~/.promotion/config.yaml", "a configuration file with the access tokens for hosts")
 	rootCmd.PersistentFlags().Bool(insecureSkipVerifyFlag, false, "Insecure skip verify TLS certificate")
 	rootCmd.PersistentFlags().String(repoTypeFlag, "github", "the type of repository: github, gitlab or ghe")
-
-	logIfError(cobra.MarkFlagRequired(rootCmd.PersistentFlags(), githubTokenFlag))
+	rootCmd.PersistentFlags().Int(retriesFlag, retry.DefaultPolicy.Attempts-1, "how many times to retry clones, fetches, pushes and pull request creation that fail with transient errors, e.g. server errors (no retries if 0)")
+	rootCmd.PersistentFlags().Duration(retryDelayFlag, retry.DefaultPolicy.InitialDelay, "how long to wait before the first retry, the wait is doubled for each later retry")
+	rootCmd.PersistentFlags().Duration(timeoutFlag, 0, "how long to wait for the command to finish before stopping it, e.g. 10m (no timeout if 0)")
 
 	cobra.OnInitialize(func() {
 		viper.AutomaticEnv()
@@ -56,6 +95,11 @@ func postInitCommands(commands []*cobra.Command) {
 func presetRequiredFlags(cmd *cobra.Command) {
 	logIfError(viper.BindPFlags(cmd.Flags()))
 	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		// Setting a slice or array flag appends to its values, so the values
+		// that were given on the command line aren't set again.
+		if _, ok := f.Value.(pflag.SliceValue); ok && f.Changed {
+			return
+		}
 		if viper.IsSet(f.Name) && viper.GetString(f.Name) != "" {
 			logIfError(cmd.Flags().Set(f.Name, viper.GetString(f.Name)))
 		}
@@ -68,14 +112,40 @@ func Execute() {
 		emailFlag,
 		msgFlag,
 		nameFlag,
+		committerNameFlag,
+		committerEmailFlag,
+		coAuthorFlag,
+		signKeyFlag,
+		signFormatFlag,
 		debugFlag,
+		logFormatFlag,
+		logLevelFlag,
 		githubTokenFlag,
+		tokenFileFlag,
+		configFlag,
+		githubAppIDFlag,
+		githubAppInstallFlag,
+		githubAppKeyFlag,
+		githubAppHostFlag,
 		insecureSkipVerifyFlag,
 		repoTypeFlag,
+		retriesFlag,
+		retryDelayFlag,
+		timeoutFlag,
 	})
 
-	if err := rootCmd.Execute(); err != nil {
-		log.Fatal(err)
+	rootCmd.SetFlagErrorFunc(flagError)
+	ctx, stop := newSignalContext()
+	err := commandLineError(rootCmd.ExecuteContext(ctx))
+	stop()
+	if err != nil {
+		logger, logErr := newLogger()
+		if logErr != nil {
+			log.Print(secrets.Redact(err.Error()))
+		} else {
+			logger.Error(err.Error())
+		}
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -90,3 +160,12 @@ func bindFlags(set *pflag.FlagSet, flags []string) {
 		logIfError(viper.BindPFlag(f, set.Lookup(f)))
 	}
 }
+
+// stringArrayFlag returns the values of a repeatable flag, or nil if the
+// command doesn't have the flag.
+func stringArrayFlag(c *cobra.Command, name string) ([]string, error) {
+	if c.Flags().Lookup(name) == nil {
+		return nil, nil
+	}
+	return c.Flags().GetStringArray(name)
+}
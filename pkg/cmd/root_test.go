@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestPresetRequiredFlagsKeepsRepeatedFlags(t *testing.T) {
+	defer viper.Reset()
+	c := &cobra.Command{Use: "test"}
+	c.Flags().StringArray(coAuthorFlag, nil, "")
+	c.Flags().String(nameFlag, "", "")
+	if err := c.Flags().Parse([]string{"--co-author", `"User, A" <a.user@example.com>`, "--co-author", "B User <b.user@example.com>"}); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set(nameFlag, "Testing User")
+
+	presetRequiredFlags(c)
+
+	got, err := c.Flags().GetStringArray(coAuthorFlag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`"User, A" <a.user@example.com>`, "B User <b.user@example.com>"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+	if name, _ := c.Flags().GetString(nameFlag); name != "Testing User" {
+		t.Fatalf("got name %q, want it set from the configuration", name)
+	}
+}
+
+func TestPresetRequiredFlagsSetsArrayFromEnvironment(t *testing.T) {
+	defer viper.Reset()
+	c := &cobra.Command{Use: "test"}
+	c.Flags().StringArray(coAuthorFlag, nil, "")
+	viper.Set(coAuthorFlag, "A User <a.user@example.com>")
+
+	presetRequiredFlags(c)
+	presetRequiredFlags(c)
+
+	got, err := c.Flags().GetStringArray(coAuthorFlag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A User <a.user@example.com>"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestErrorsAreNotPrintedByCobra(t *testing.T) {
+	defer viper.Reset()
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs([]string{"promote", "--unknown"})
+	defer func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		rootCmd.SetArgs(nil)
+	}()
+
+	if err := rootCmd.ExecuteContext(context.Background()); err == nil {
+		t.Fatal("expected an error for the unknown flag")
+	}
+	if out.Len() != 0 {
+		t.Fatalf("got output %q, want the error only to be logged", out.String())
+	}
+}
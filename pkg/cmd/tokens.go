@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/spf13/viper"
+)
+
+// newTokens finds the access tokens for the repositories, from a GitHub App,
+// the --github-token or --token-file, the hosts in the configuration file, and
+// git's credential helpers.
+func newTokens() (*git.Tokens, error) {
+	token := viper.GetString(githubTokenFlag)
+	if tokenFile := viper.GetString(tokenFileFlag); tokenFile != "" {
+		if token != "" {
+			return nil, fmt.Errorf("only one of --%s and --%s can be provided", githubTokenFlag, tokenFileFlag)
+		}
+		filename, err := homedir.Expand(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand the token file path: %w", err)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+		if token == "" {
+			return nil, errors.New("the token file is empty")
+		}
+	}
+
+	hosts := map[string]string{}
+	if config := viper.GetString(configFlag); config != "" {
+		filename, err := homedir.Expand(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand the config path: %w", err)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read the config: %w", err)
+		}
+		if err == nil {
+			if hosts, err = git.ParseHostTokens(data); err != nil {
+				return nil, fmt.Errorf("failed to read the config %s: %w", filename, err)
+			}
+		}
+	}
+	apps, err := newGitHubApps()
+	if err != nil {
+		return nil, err
+	}
+	return &git.Tokens{Default: token, Hosts: hosts, Apps: apps, CredentialHelpers: true, Secrets: secrets}, nil
+}
+
+// newGitHubApps returns the GitHub App to authenticate with for its host, if
+// one is configured.
+func newGitHubApps() (map[string]*git.GitHubApp, error) {
+	appID := viper.GetInt64(githubAppIDFlag)
+	if appID == 0 {
+		return nil, nil
+	}
+	installationID := viper.GetInt64(githubAppInstallFlag)
+	if installationID == 0 {
+		return nil, fmt.Errorf("--%s is required with --%s", githubAppInstallFlag, githubAppIDFlag)
+	}
+	keyFile := viper.GetString(githubAppKeyFlag)
+	if keyFile == "" {
+		return nil, fmt.Errorf("--%s is required with --%s", githubAppKeyFlag, githubAppIDFlag)
+	}
+	filename, err := homedir.Expand(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand the private key path: %w", err)
+	}
+	keyPEM, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the GitHub App's private key: %w", err)
+	}
+	host := strings.ToLower(viper.GetString(githubAppHostFlag))
+	app, err := git.NewGitHubApp(appID, installationID, keyPEM, git.AppAPIURL(host))
+	if err != nil {
+		return nil, err
+	}
+	if viper.GetBool(insecureSkipVerifyFlag) {
+		app.HTTPClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		}
+	}
+	return map[string]*git.GitHubApp{host: app}, nil
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/promotion"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "validate the layout of a GitOps repository",
+	RunE:  validateAction,
+}
+
+const branchFlag = "branch"
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().String(repoFlag, "", "the GitOps repository to validate (URL or local)")
+	validateCmd.Flags().String(branchFlag, "master", "the branch on the Git repository")
+	validateCmd.Flags().String(cacheDirFlag, "~/.promotion/cache", "where to cache Git checkouts")
+	validateCmd.Flags().Bool(keepCacheFlag, false, "whether to retain the locally cloned repository in the cache directory")
+	validateCmd.Flags().Duration(lockTimeoutFlag, git.DefaultLockTimeout, "how long to wait for other runs sharing the cache to release a repository")
+
+	logIfError(validateCmd.MarkFlagRequired(repoFlag))
+}
+
+func validateAction(c *cobra.Command, args []string) error {
+	bindFlags(c.Flags(), []string{
+		repoFlag,
+		branchFlag,
+		cacheDirFlag,
+		keepCacheFlag,
+		lockTimeoutFlag,
+	})
+
+	location := promotion.EnvLocation{
+		RepoPath: viper.GetString(repoFlag),
+		Branch:   viper.GetString(branchFlag),
+	}
+	keepCache := viper.GetBool(keepCacheFlag)
+
+	// Validation doesn't commit anything, so there's no need for a full author.
+	sm, err := newServiceManagerForAuthor(c, &git.Author{})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(c.Context())
+	defer cancel()
+	return sm.Validate(ctx, location, keepCache)
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestValidateCommand(t *testing.T) {
+	defer viper.Reset()
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repo := filepath.Join(dir, "gitops")
+	config := filepath.Join(repo, "environments", "dev", "services", "my-service", "base", "config")
+	if err := os.MkdirAll(config, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(config, "deployment.yaml"), []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: my-service\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"validate", "--repo", repo, "--cache-dir", filepath.Join(dir, "cache"), "--config", filepath.Join(dir, "config.yaml")})
+	defer rootCmd.SetArgs(nil)
+
+	if err := rootCmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
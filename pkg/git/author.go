@@ -1,9 +1,109 @@
 package git
 
-// Author represents the details needed to commit and push to Git, including the
-// auth-token to use when pushing upstream.
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// Identity is the name and email address that commits are attributed to.
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// ParseIdentity parses an identity in the form used by Git, e.g.
+// "A User <a.user@example.com>".
+func ParseIdentity(s string) (Identity, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name == "" {
+		return Identity{}, fmt.Errorf("invalid identity %q, must be of the form \"Name <email>\"", s)
+	}
+	return Identity{Name: addr.Name, Email: addr.Address}, nil
+}
+
+// String returns the identity in the form used by Git, e.g.
+// "A User <a.user@example.com>".
+func (i Identity) String() string {
+	return fmt.Sprintf("%s <%s>", i.Name, i.Email)
+}
+
+// Author represents the details needed to commit to Git.
+//
+// The commits are authored by the Name and Email, and can be committed by a
+// separate Committer, e.g. a bot account committing on behalf of the developer
+// whose build triggered the promotion.
 type Author struct {
 	Name  string
 	Email string
-	Token string
+	// Committer commits the changes, if it's nil the author is the committer.
+	Committer *Identity
+	// CoAuthors are credited with Co-authored-by trailers in the commit
+	// message.
+	CoAuthors []Identity
+	// Signing signs the commits, if it's not nil.
+	Signing *Signing
+}
+
+// committer returns the identity that commits the changes.
+func (a *Author) committer() Identity {
+	if a.Committer != nil {
+		return *a.Committer
+	}
+	return Identity{Name: a.Name, Email: a.Email}
+}
+
+// env returns the environment that sets the author and committer of commits,
+// so that the identities aren't written to the repository's configuration.
+func (a *Author) env() []string {
+	committer := a.committer()
+	return []string{
+		"GIT_AUTHOR_NAME=" + a.Name,
+		"GIT_AUTHOR_EMAIL=" + a.Email,
+		"GIT_COMMITTER_NAME=" + committer.Name,
+		"GIT_COMMITTER_EMAIL=" + committer.Email,
+	}
+}
+
+// commitMessage returns the message with a Co-authored-by trailer for each of
+// the co-authors, other than the author.
+func (a *Author) commitMessage(msg string) string {
+	var trailers []string
+	for _, c := range a.CoAuthors {
+		if strings.EqualFold(c.Email, a.Email) {
+			continue
+		}
+		trailer := "Co-authored-by: " + c.String()
+		if !hasString(trailer, trailers) {
+			trailers = append(trailers, trailer)
+		}
+	}
+	return AppendTrailers(msg, trailers...)
+}
+
+var trailerLine = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*: `)
+
+// AppendTrailers returns the commit message with the trailers, e.g.
+// "Co-authored-by: A User <a.user@example.com>", added to the trailers that
+// end the message, or in a new paragraph if it doesn't end with trailers.
+func AppendTrailers(msg string, trailers ...string) string {
+	if len(trailers) == 0 {
+		return msg
+	}
+	msg = strings.TrimRight(msg, "\n")
+	separator := "\n\n"
+	if i := strings.LastIndex(msg, "\n\n"); i >= 0 && isTrailers(msg[i+2:]) {
+		separator = "\n"
+	}
+	return msg + separator + strings.Join(trailers, "\n")
+}
+
+func isTrailers(paragraph string) bool {
+	for _, line := range strings.Split(paragraph, "\n") {
+		if !trailerLine.MatchString(line) {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,92 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rhd-gitops-example/services/test"
+)
+
+func TestParseIdentity(t *testing.T) {
+	got, err := ParseIdentity("A Developer <developer@example.com>")
+	assertNoError(t, err)
+	if want := (Identity{Name: "A Developer", Email: "developer@example.com"}); got != want {
+		t.Fatalf("ParseIdentity() got %#v, want %#v", got, want)
+	}
+
+	for _, s := range []string{"developer@example.com", "A Developer", "A Developer <>"} {
+		_, err := ParseIdentity(s)
+		test.AssertErrorMatch(t, `must be of the form "Name <email>"`, err)
+	}
+}
+
+func TestAuthorEnv(t *testing.T) {
+	author := &Author{Name: "A Developer", Email: "developer@example.com"}
+	want := []string{
+		"GIT_AUTHOR_NAME=A Developer",
+		"GIT_AUTHOR_EMAIL=developer@example.com",
+		"GIT_COMMITTER_NAME=A Developer",
+		"GIT_COMMITTER_EMAIL=developer@example.com",
+	}
+	if diff := cmp.Diff(want, author.env()); diff != "" {
+		t.Fatalf("env didn't match: %s", diff)
+	}
+
+	author.Committer = &Identity{Name: "Promotion Bot", Email: "bot@example.com"}
+	want[2], want[3] = "GIT_COMMITTER_NAME=Promotion Bot", "GIT_COMMITTER_EMAIL=bot@example.com"
+	if diff := cmp.Diff(want, author.env()); diff != "" {
+		t.Fatalf("env didn't match: %s", diff)
+	}
+}
+
+func TestAuthorCommitMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		coAuthors []Identity
+		want      string
+	}{
+		{"no co-authors", nil, "Promote service-a\n"},
+		{
+			"co-authors",
+			[]Identity{{Name: "Another Developer", Email: "another@example.com"}, {Name: "Third Developer", Email: "third@example.com"}},
+			"Promote service-a\n\nCo-authored-by: Another Developer <another@example.com>\nCo-authored-by: Third Developer <third@example.com>",
+		},
+		{
+			"author and duplicates are skipped",
+			[]Identity{{Name: "A Developer", Email: "Developer@example.com"}, {Name: "Another Developer", Email: "another@example.com"}, {Name: "Another Developer", Email: "another@example.com"}},
+			"Promote service-a\n\nCo-authored-by: Another Developer <another@example.com>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(rt *testing.T) {
+			author := &Author{Name: "A Developer", Email: "developer@example.com", CoAuthors: tt.coAuthors}
+			if got := author.commitMessage("Promote service-a\n"); got != tt.want {
+				rt.Errorf("commitMessage() got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendTrailers(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{"subject", "Promote service-a\n", "Promote service-a\n\nCo-authored-by: A Developer <developer@example.com>"},
+		{"subject that looks like a trailer", "fix: Promote service-a", "fix: Promote service-a\n\nCo-authored-by: A Developer <developer@example.com>"},
+		{"body", "Promote service-a\n\nThe tested version.", "Promote service-a\n\nThe tested version.\n\nCo-authored-by: A Developer <developer@example.com>"},
+		{
+			"existing trailers",
+			"Promote service-a\n\nPromoted-Ref: v1.2.0 (a1b2c3d)\n",
+			"Promote service-a\n\nPromoted-Ref: v1.2.0 (a1b2c3d)\nCo-authored-by: A Developer <developer@example.com>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(rt *testing.T) {
+			if got := AppendTrailers(tt.msg, "Co-authored-by: A Developer <developer@example.com>"); got != tt.want {
+				rt.Errorf("AppendTrailers() got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rhd-gitops-example/services/pkg/logging"
+)
+
+// Cache is a directory of bare mirrors of remote repositories, the branches
+// that are promoted are checked out to worktrees of the mirrors, so each
+// repository is only cloned once, and later promotions only fetch the changes.
+//
+// The mirrors can be shared by promotions running at the same time, changes to
+// a mirror and its worktrees are serialised with a lock file beside the mirror.
+type Cache struct {
+	Dir string
+	// LockTimeout is how long to wait for another promotion to release the
+	// lock on a mirror, DefaultLockTimeout is used if it's not set.
+	LockTimeout time.Duration
+	// Tokens finds the access tokens used to authenticate with the remote
+	// repositories, they're not written to the cache.
+	Tokens *Tokens
+}
+
+// NewCache creates and returns a Cache of the repositories in dir.
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// MirrorPath returns the path to the bare mirror of a repository, the mirror is
+// shared by all the URLs for the repository regardless of the credentials in
+// them, or a .git suffix.
+func (c *Cache) MirrorPath(repoURL string) (string, error) {
+	cleanedURL, err := CleanURL(repoURL)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(c.Dir, "mirrors", url.QueryEscape(strings.TrimSuffix(cleanedURL, ".git"))+".git"), nil
+}
+
+// NewRepository creates and returns a Repository that is checked out to a
+// worktree of the mirror of the repository in localPath.
+//
+// The mirror is cloned, or fetched if it's already cached, and the worktree
+// created when the Repository is cloned.
+func (c *Cache) NewRepository(repoURL, localPath string, tlsVerify bool, logger logging.Logger) (*Repository, error) {
+	mirror, err := c.MirrorPath(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewRepository(repoURL, localPath, tlsVerify, logger)
+	if err != nil {
+		return nil, err
+	}
+	r.mirror = mirror
+	r.lockTimeout = c.LockTimeout
+	if c.Tokens != nil {
+		r.SetTokenSource(func(ctx context.Context) (string, error) {
+			return c.Tokens.Token(ctx, repoURL)
+		})
+	}
+	return r, nil
+}
+
+// cloneWorktree clones the mirror of the repository, or fetches it if it's
+// already cached, and adds a worktree for the repository if there's not one
+// from an earlier promotion.
+func (r *Repository) cloneWorktree() error {
+	if err := os.MkdirAll(path.Dir(r.mirror), 0755); err != nil {
+		return fmt.Errorf("error creating the cache dir %s: %w", path.Dir(r.mirror), err)
+	}
+	if err := r.updateMirror(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(r.repoPath()); !os.IsNotExist(err) {
+		return r.recordUse("")
+	}
+	if err := os.MkdirAll(r.LocalPath, 0755); err != nil {
+		return fmt.Errorf("error creating the cache dir %s: %w", r.LocalPath, err)
+	}
+	// Clear out the worktrees of earlier promotions that were deleted.
+	if _, err := r.execGit(r.mirror, nil, "worktree", "prune"); err != nil {
+		return err
+	}
+	if _, err := r.execGit(r.mirror, nil, "worktree", "add", "--detach", r.repoPath()); err != nil {
+		return err
+	}
+	return r.recordUse("")
+}
+
+// updateMirror clones the bare mirror of the repository, or fetches the
+// branches if it's already cached.
+//
+// The branches are fetched as remote branches, the same as a normal clone, so
+// that they can be checked out in worktrees.
+func (r *Repository) updateMirror() error {
+	if _, err := os.Stat(r.mirror); !os.IsNotExist(err) {
+		// The URL is updated to remove the credentials that were added to it by
+		// earlier versions.
+		if _, err := r.execGit(r.mirror, nil, "remote", "set-url", "origin", r.RepoURL); err != nil {
+			return err
+		}
+		_, err = r.execGit(r.mirror, nil, "fetch", "--prune", "origin")
+		return err
+	}
+
+	// A clone that's stopped part way through, e.g. by a timeout, is removed,
+	// so that it's cloned again rather than fetched by later promotions.
+	if _, err := r.execGit(path.Dir(r.mirror), nil, "clone", "--bare", r.RepoURL, r.mirror); err != nil {
+		os.RemoveAll(r.mirror)
+		return err
+	}
+	if _, err := r.execGit(r.mirror, nil, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+		os.RemoveAll(r.mirror)
+		return err
+	}
+	return nil
+}
+
+// lockWorktree locks the worktree of the repository, if it's not already
+// locked, the lock is held until the repository is released.
+func (r *Repository) lockWorktree() error {
+	if r.worktreeLock != nil {
+		return nil
+	}
+	l, err := acquireLock(r.commandContext(), r.LocalPath+lockSuffix, r.timeout())
+	if err != nil {
+		return err
+	}
+	r.worktreeLock = l
+	return nil
+}
+
+// Release releases the worktree of the repository in the cache, so that it can
+// be removed by Cache.Clean and Cache.Prune, DeleteCache releases the worktree
+// after removing it.
+func (r *Repository) Release() error {
+	if r.worktreeLock == nil {
+		return nil
+	}
+	l := r.worktreeLock
+	r.worktreeLock = nil
+	return l.Remove()
+}
+
+// removeWorktree removes the worktree of the repository, the mirror is kept
+// for later promotions.
+func (r *Repository) removeWorktree() error {
+	if err := os.RemoveAll(r.LocalPath); err != nil {
+		return fmt.Errorf("failed deleting `%s` : %w", r.LocalPath, err)
+	}
+	if err := os.Remove(r.LocalPath + metadataSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// The mirror doesn't exist if the clone failed.
+	if _, err := os.Stat(r.mirror); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := r.execGitContext(context.Background(), r.mirror, nil, "worktree", "prune"); err != nil {
+		return fmt.Errorf("failed to prune the worktrees of %s: %w", r.mirror, err)
+	}
+	return nil
+}
@@ -0,0 +1,391 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The kinds of entries in the cache.
+const (
+	MirrorEntry   = "mirror"
+	WorktreeEntry = "worktree"
+)
+
+// metadataSuffix is appended to the path of a mirror or worktree for the file
+// its metadata is recorded in.
+const metadataSuffix = ".json"
+
+// CacheEntry is a mirror or worktree in the cache, the metadata is recorded in
+// a file beside it each time it's used.
+type CacheEntry struct {
+	// Path is the path to the mirror, or the directory the worktree is in.
+	Path string `json:"-"`
+	Kind string `json:"kind"`
+	// URL is the URL of the repository, without any credentials.
+	URL string `json:"url"`
+	// Mirror is the path to the mirror of a worktree.
+	Mirror string `json:"mirror,omitempty"`
+	// Branches are the branches that have been checked out.
+	Branches []string  `json:"branches,omitempty"`
+	LastUsed time.Time `json:"lastUsed"`
+	// Size is the disk usage in bytes, it's calculated when the cache is
+	// listed.
+	Size int64 `json:"-"`
+}
+
+// Entries returns the mirrors and worktrees in the cache, ordered by URL, with
+// the mirror of a repository before its worktrees.
+//
+// The directories in the cache without metadata, e.g. from older versions, or
+// with metadata that can't be read, are not returned.
+func (c *Cache) Entries() ([]CacheEntry, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+	sized := []CacheEntry{}
+	for _, entry := range entries {
+		entry.Size, err = diskUsage(entry.Path)
+		if os.IsNotExist(err) {
+			// The worktree was deleted by the promotion that was using it.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate the size of %s: %w", entry.Path, err)
+		}
+		sized = append(sized, entry)
+	}
+	sort.SliceStable(sized, func(i, j int) bool {
+		if sized[i].URL != sized[j].URL {
+			return sized[i].URL < sized[j].URL
+		}
+		if sized[i].Kind != sized[j].Kind {
+			return sized[i].Kind == MirrorEntry
+		}
+		return sized[i].Path < sized[j].Path
+	})
+	return sized, nil
+}
+
+// entries reads the metadata of the mirrors and worktrees in the cache.
+//
+// The mirrors and worktrees are in a directory for each kind, e.g. the mirrors
+// are in c.Dir/mirrors, the directories inside them, e.g. the checkouts of the
+// repositories, are not read.
+func (c *Cache) entries() ([]CacheEntry, error) {
+	entries := []CacheEntry{}
+	groups, err := ioutil.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if !group.IsDir() {
+			continue
+		}
+		dirs, err := ioutil.ReadDir(filepath.Join(c.Dir, group.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			entry, err := readCacheEntry(filepath.Join(c.Dir, group.Name(), dir.Name()) + metadataSuffix)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Prune removes the entries that have not been used since the time, the
+// worktrees of a removed mirror are also removed, and returns the removed
+// entries.
+//
+// The worktrees that are in use by running promotions, and their mirrors, are
+// not removed.
+func (c *Cache) Prune(before time.Time) ([]CacheEntry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	removedMirrors := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Kind == MirrorEntry && entry.LastUsed.Before(before) {
+			removedMirrors[entry.Path] = true
+		}
+	}
+	removed := []CacheEntry{}
+	for _, entry := range entries {
+		if !entry.LastUsed.Before(before) && !removedMirrors[entry.Mirror] {
+			continue
+		}
+		ok, err := c.remove(entry)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			removed = append(removed, entry)
+		}
+	}
+	return removed, nil
+}
+
+// leftoverMinAge is how long a directory in the cache without metadata must be
+// unchanged before Clean removes it, so that the mirrors and worktrees being
+// created by running promotions aren't removed.
+const leftoverMinAge = 10 * time.Minute
+
+// Clean removes the mirrors and worktrees in the cache, and the directories
+// without metadata, e.g. left by older versions, or by promotions that were
+// killed part way through a clone.
+//
+// The worktrees that are in use by running promotions, and their mirrors, are
+// kept. The directories without metadata that are locked, or that were changed
+// in the last leftoverMinAge, are kept as they can belong to running
+// promotions, as are the locks on the mirrors, which can be waited on by other
+// promotions.
+func (c *Cache) Clean() error {
+	entries, err := c.Entries()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := c.remove(entry); err != nil {
+			return err
+		}
+	}
+	return c.removeLeftovers(time.Now().Add(-leftoverMinAge))
+}
+
+// removeLeftovers removes the mirrors and worktrees without metadata that were
+// last changed before the time, and aren't locked.
+//
+// The mirrors and worktrees are in a directory for each kind, e.g. the mirrors
+// are in c.Dir/mirrors, directories elsewhere in the cache are not removed.
+func (c *Cache) removeLeftovers(before time.Time) error {
+	groups, err := ioutil.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if !group.IsDir() {
+			continue
+		}
+		dirs, err := ioutil.ReadDir(filepath.Join(c.Dir, group.Name()))
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			p := filepath.Join(c.Dir, group.Name(), dir.Name())
+			if !dir.IsDir() || !dir.ModTime().Before(before) {
+				continue
+			}
+			if _, err := readCacheEntry(p + metadataSuffix); err == nil {
+				continue
+			}
+			if err := removeUnlocked(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeUnlocked removes the directory and any metadata, unless it's locked by
+// a promotion, the lock file is kept.
+func removeUnlocked(dir string) error {
+	lockPath := dir + lockSuffix
+	if _, err := os.Stat(lockPath); err == nil {
+		f, err := tryLock(lockPath)
+		if err == errLocked {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock %s: %w", lockPath, err)
+		}
+		defer unlock(f)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed deleting `%s` : %w", dir, err)
+	}
+	if err := os.Remove(dir + metadataSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// remove deletes an entry and its metadata, and returns true if it was removed.
+//
+// A worktree isn't removed if it's locked by a running promotion, and a mirror
+// isn't removed if any of its worktrees are, the mirror is locked while it's
+// removed, or while its worktree is pruned.
+func (c *Cache) remove(entry CacheEntry) (bool, error) {
+	if entry.Kind == WorktreeEntry {
+		f, err := tryLock(entry.Path + lockSuffix)
+		if err == errLocked {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to lock %s: %w", entry.Path+lockSuffix, err)
+		}
+		defer (&fileLock{f: f}).Remove()
+	}
+	mirror := entry.Path
+	if entry.Kind == WorktreeEntry && entry.Mirror != "" {
+		mirror = entry.Mirror
+	}
+	l, err := acquireLock(context.Background(), mirror+lockSuffix, c.lockTimeout())
+	if err != nil {
+		return false, err
+	}
+	defer l.Release()
+
+	// While the mirror is locked no worktrees are added to it, so the
+	// worktrees that are in use all have metadata.
+	if entry.Kind == MirrorEntry {
+		inUse, err := c.worktreesInUse(mirror)
+		if err != nil || inUse {
+			return false, err
+		}
+	}
+
+	if err := os.RemoveAll(entry.Path); err != nil {
+		return false, fmt.Errorf("failed deleting `%s` : %w", entry.Path, err)
+	}
+	if err := os.Remove(entry.Path + metadataSuffix); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if entry.Kind == WorktreeEntry {
+		if _, err := os.Stat(mirror); err == nil {
+			r := &Repository{tlsVerify: true}
+			if _, err := r.execGit(mirror, nil, "worktree", "prune"); err != nil {
+				return false, fmt.Errorf("failed to prune the worktrees of %s: %w", mirror, err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// worktreesInUse returns true if any of the worktrees of the mirror are locked
+// by running promotions.
+func (c *Cache) worktreesInUse(mirror string) (bool, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.Kind != WorktreeEntry || entry.Mirror != mirror {
+			continue
+		}
+		// Worktrees are only locked while they're in use.
+		if _, err := os.Stat(entry.Path + lockSuffix); os.IsNotExist(err) {
+			continue
+		}
+		f, err := tryLock(entry.Path + lockSuffix)
+		if err == errLocked {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to lock %s: %w", entry.Path+lockSuffix, err)
+		}
+		if err := unlock(f); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (c *Cache) lockTimeout() time.Duration {
+	if c.LockTimeout == 0 {
+		return DefaultLockTimeout
+	}
+	return c.LockTimeout
+}
+
+// recordUse records the metadata for the worktree of the repository and its
+// mirror, including the branch if it's not empty.
+func (r *Repository) recordUse(branch string) error {
+	if r.mirror == "" {
+		return nil
+	}
+	cleanedURL, err := CleanURL(r.RepoURL)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range []CacheEntry{
+		{Path: r.mirror, Kind: MirrorEntry, URL: cleanedURL},
+		{Path: r.LocalPath, Kind: WorktreeEntry, URL: cleanedURL, Mirror: r.mirror},
+	} {
+		if existing, err := readCacheEntry(entry.Path + metadataSuffix); err == nil {
+			entry.Branches = existing.Branches
+		}
+		if branch != "" && !hasString(branch, entry.Branches) {
+			entry.Branches = append(entry.Branches, branch)
+		}
+		entry.LastUsed = now
+		if err := writeCacheEntry(entry); err != nil {
+			return fmt.Errorf("failed to record the use of %s in the cache: %w", entry.Path, err)
+		}
+	}
+	return nil
+}
+
+func readCacheEntry(filename string) (CacheEntry, error) {
+	var entry CacheEntry
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return entry, err
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, fmt.Errorf("failed to parse the cache metadata in %s: %w", filename, err)
+	}
+	entry.Path = filename[:len(filename)-len(metadataSuffix)]
+	return entry, nil
+}
+
+func writeCacheEntry(entry CacheEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(entry.Path+metadataSuffix, data, 0644)
+}
+
+func diskUsage(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func hasString(find string, list []string) bool {
+	for _, s := range list {
+		if s == find {
+			return true
+		}
+	}
+	return false
+}
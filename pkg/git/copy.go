@@ -1,26 +1,32 @@
 package git
 
 import (
+	"fmt"
+	"os"
 	"path"
-	"path/filepath"
 	"strings"
 )
 
 // CopyService takes the name of a service to copy from a Source to a Destination.
 // Source, Destination implement Walk() and are typically Repository objects.
 //
-// Only files under /services/[serviceName]/base/config/* are copied to the destination
+// Only files in the service's configuration folder in the Source's Layout are
+// copied to the service's configuration folder in the Destination's Layout,
+// for the default layout these are under /services/[serviceName]/base/config/*
 //
 // Returns the list of files that were copied, and possibly an error.
 func CopyService(serviceName string, source Source, dest Destination, sourceEnvironment, destinationEnvironment string) ([]string, error) {
+	sourceLayout, destLayout := layoutOf(source), layoutOf(dest)
 	// filePath defines the root folder for serviceName's config in the repository
 	// the lookup is done for the source repository
-	filePath := pathForServiceConfig(serviceName, sourceEnvironment)
+	filePath := sourceLayout.ServicePath(serviceName, sourceEnvironment)
+	configPath := sourceLayout.ConfigPath(serviceName, sourceEnvironment)
 	copied := []string{}
 	err := source.Walk(filePath, func(prefix, name string) error {
 		sourcePath := path.Join(prefix, name)
-		destPath := pathForServiceConfig(name, destinationEnvironment)
-		if pathValidForPromotion(serviceName, destPath, destinationEnvironment) {
+		repoPath := path.Join(path.Dir(filePath), name)
+		if sourceLayout.pathValidForPromotion(serviceName, repoPath, sourceEnvironment) {
+			destPath := path.Join(destLayout.ConfigPath(serviceName, destinationEnvironment), strings.TrimPrefix(repoPath, configPath+"/"))
 			err := dest.CopyFile(sourcePath, destPath)
 			if err == nil {
 				copied = append(copied, destPath)
@@ -33,15 +39,38 @@ func CopyService(serviceName string, source Source, dest Destination, sourceEnvi
 	return copied, err
 }
 
-//  For a given serviceName, only files in environments/envName/services/serviceName/base/config/* are valid for promotion
-func pathValidForPromotion(serviceName, filePath, environmentName string) bool {
-	filterPath := filepath.Join(pathForServiceConfig(serviceName, environmentName), "base", "config")
-	validPath := strings.HasPrefix(filePath, filterPath)
-	return validPath
-}
+// PruneService takes the name of a service, and removes the files in the
+// service's configuration in the Repo that are not listed in keep.
+//
+// Returns the list of files that were removed, and possibly an error.
+func PruneService(serviceName string, r Repo, environmentName string, keep []string) ([]string, error) {
+	layout := r.Layout()
+	filePath := layout.ServicePath(serviceName, environmentName)
+	existing := []string{}
+	err := r.Walk(filePath, func(prefix, name string) error {
+		destPath := path.Join(path.Dir(filePath), name)
+		if layout.pathValidForPromotion(serviceName, destPath, environmentName) {
+			existing = append(existing, destPath)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
 
-// pathForServiceConfig defines where in a 'gitops' repository the config for a given service should live.
-func pathForServiceConfig(serviceName, environmentName string) string {
-	pathForConfig := filepath.Join("environments", environmentName, "services", serviceName)
-	return pathForConfig
+	kept := map[string]bool{}
+	for _, k := range keep {
+		kept[path.Clean(k)] = true
+	}
+	removed := []string{}
+	for _, f := range existing {
+		if kept[f] {
+			continue
+		}
+		if err := r.RemoveFile(f); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", f, err)
+		}
+		removed = append(removed, f)
+	}
+	return removed, nil
 }
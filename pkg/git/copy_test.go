@@ -43,11 +43,11 @@ func TestPathValidForPromotion(t *testing.T) {
 		"environments/dev/services/service-name/base/config/dir/below/it/may/contain/important.yaml",
 	}
 	for _, filePath := range promoteTheseWhenServiceNameIsRight {
-		if !pathValidForPromotion(serviceBeingPromoted, filePath, "dev") {
+		if !DefaultLayout.pathValidForPromotion(serviceBeingPromoted, filePath, "dev") {
 			t.Fatalf("Valid path for promotion for %s incorrectly rejected: %s", serviceBeingPromoted, filePath)
 		}
 		for _, wrongService := range servicesNotBeingPromoted {
-			if pathValidForPromotion(wrongService, filePath, "dev") {
+			if DefaultLayout.pathValidForPromotion(wrongService, filePath, "dev") {
 				t.Fatalf("Path for service %s incorrectly accepted for promotion: %s", wrongService, filePath)
 			}
 		}
@@ -65,7 +65,7 @@ func TestPathValidForPromotion(t *testing.T) {
 	}
 	for _, badPath := range neverPromoteThese {
 		for _, badServiceName := range badServiceNames {
-			if pathValidForPromotion(badServiceName, badPath, "") {
+			if DefaultLayout.pathValidForPromotion(badServiceName, badPath, "") {
 				t.Fatalf("Invalid path %s for promotion of service %s incorrectly accepted", badPath, badServiceName)
 			}
 		}
@@ -75,7 +75,7 @@ func TestPathValidForPromotion(t *testing.T) {
 func TestPathForServiceConfig(t *testing.T) {
 	serviceName := "usefulService"
 	correctPath := "environments/dev/services/usefulService"
-	serviceConfigPath := pathForServiceConfig(serviceName, "dev")
+	serviceConfigPath := DefaultLayout.ServicePath(serviceName, "dev")
 	if serviceConfigPath != correctPath {
 		t.Fatalf("Invalid result for pathForServiceConfig(%s): wanted %s got %s", serviceName, correctPath, serviceConfigPath)
 	}
@@ -170,3 +170,43 @@ func (d *mockDestination) assertFilesWritten(t *testing.T, want []string) {
 		t.Fatalf("written files do not match: %s", diff)
 	}
 }
+
+func TestPruneService(t *testing.T) {
+	r, cleanup := makeLocalRepository(t, map[string]string{
+		"environments/staging/services/service-a/base/config/deployment.yaml": "kind: Deployment\n",
+		"environments/staging/services/service-a/base/config/old.yaml":        "kind: ConfigMap\n",
+		"environments/staging/services/service-a/README.md":                   "not promoted\n",
+		"environments/staging/services/service-b/base/config/old.yaml":        "kind: ConfigMap\n",
+	})
+	defer cleanup()
+
+	removed, err := PruneService("service-a", r, "staging", []string{"environments/staging/services/service-a/base/config/deployment.yaml"})
+	assertNoError(t, err)
+
+	want := []string{"environments/staging/services/service-a/base/config/old.yaml"}
+	if diff := cmp.Diff(want, removed); diff != "" {
+		t.Fatalf("removed files did not match: %s", diff)
+	}
+	for _, f := range []string{
+		"environments/staging/services/service-a/base/config/deployment.yaml",
+		"environments/staging/services/service-a/README.md",
+		"environments/staging/services/service-b/base/config/old.yaml",
+	} {
+		if _, err := r.ReadFile(f); err != nil {
+			t.Errorf("expected %s to be kept: %s", f, err)
+		}
+	}
+}
+
+func TestPruneServiceWithNewService(t *testing.T) {
+	r, cleanup := makeLocalRepository(t, map[string]string{
+		"environments/staging/services/service-b/base/config/deployment.yaml": "kind: Deployment\n",
+	})
+	defer cleanup()
+
+	removed, err := PruneService("service-a", r, "staging", nil)
+	assertNoError(t, err)
+	if diff := cmp.Diff([]string{}, removed); diff != "" {
+		t.Fatalf("removed files did not match: %s", diff)
+	}
+}
@@ -1,9 +1,32 @@
 package git
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/rhd-gitops-example/services/pkg/logging"
+)
+
+// The kinds of failure, the errors returned can be checked for them with
+// errors.Is, e.g. errors.Is(err, git.ErrAuth).
+var (
+	// ErrAuth is a failure to authenticate, or a lack of permissions.
+	ErrAuth = errors.New("authentication failed")
+	// ErrNotFound is a repository, branch, ref or file that doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrNoChanges is a promotion with nothing to change.
+	ErrNoChanges = errors.New("no changes")
+	// ErrConflict is a change that conflicts with the remote, e.g. a push
+	// that isn't a fast-forward, or a pull request that already exists.
+	ErrConflict = errors.New("conflict")
+	// ErrRemoteRejected is a push that's rejected by the remote, e.g. by
+	// branch protection or a hook.
+	ErrRemoteRejected = errors.New("rejected by the remote")
 )
 
 // We can choose to throw one of these errors if we want to handle it
@@ -12,22 +35,30 @@ import (
 // some other error (e.g. to do with file permissions)
 type gitError struct {
 	msg string
+	url string
+	err error
 }
 
 // GitError returns an error whereby the user part of the url is removed (e.g. an access token)
 // Accepts the message to use and the url to remove the user part from
 func GitError(msg, url string) error {
-	cleanedURL, err := CleanURL(url)
-	if err != nil {
-		return err
+	return WrapGitError(nil, msg, url)
+}
+
+// WrapGitError returns a GitError for the error, which can be checked with
+// errors.Is and errors.As.
+func WrapGitError(err error, msg, url string) error {
+	cleanedURL, cleanErr := CleanURL(url)
+	if cleanErr != nil {
+		return cleanErr
 	}
-	return gitError{msg: fmt.Sprintf("%s. repository URL = %s", msg, cleanedURL)}
+	return gitError{msg: msg, url: cleanedURL, err: err}
 }
 
 // IsGitError performs a cast to see if an error really is of type gitError
 func IsGitError(err error) bool {
-	_, ok := err.(gitError)
-	return ok
+	var e gitError
+	return errors.As(err, &e)
 }
 
 // CleanURL removes the .User part of the string (typically an access token)
@@ -42,5 +73,199 @@ func CleanURL(inputURL string) (string, error) {
 }
 
 func (e gitError) Error() string {
+	return fmt.Sprintf("%s. repository URL = %s", e.message(), e.url)
+}
+
+// message returns the message without the URL, so that the URL is only
+// included once when GitErrors are wrapped.
+func (e gitError) message() string {
+	if e.err == nil {
+		return e.msg
+	}
+	if inner, ok := e.err.(gitError); ok {
+		return fmt.Sprintf("%s, error: %s", e.msg, inner.message())
+	}
+	return fmt.Sprintf("%s, error: %s", e.msg, e.err)
+}
+
+func (e gitError) Unwrap() error {
+	return e.err
+}
+
+// kindError is an error with its own message that is of a kind of failure,
+// e.g. ErrNotFound.
+type kindError struct {
+	kind error
+	msg  string
+	err  error
+}
+
+// Errorf formats an error of the kind of failure, e.g. ErrNotFound, errors
+// wrapped with %w can be unwrapped.
+func Errorf(kind error, format string, a ...interface{}) error {
+	err := fmt.Errorf(format, a...)
+	return &kindError{kind: kind, msg: err.Error(), err: errors.Unwrap(err)}
+}
+
+func (e *kindError) Error() string {
 	return e.msg
 }
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// CommandError is returned when a git command fails, the output of the
+// command is redacted to remove credentials.
+type CommandError struct {
+	// Command is the git command that failed, e.g. push.
+	Command string
+	// Output is the error output of the command.
+	Output string
+	// Kind is the kind of failure, e.g. ErrAuth, if it's known.
+	Kind error
+	Err  error
+}
+
+// maxErrorOutputLines is the number of lines of the output of a failed command
+// that are included in the error, the end of the output is usually the most
+// relevant.
+const maxErrorOutputLines = 10
+
+// newCommandError returns a CommandError for the command, the kind of failure
+// is identified from its output.
+func newCommandError(args []string, stdout, stderr []byte, err error, secrets ...string) *CommandError {
+	output := strings.TrimSpace(string(stderr))
+	if output == "" {
+		output = strings.TrimSpace(string(stdout))
+	}
+	if lines := strings.Split(output, "\n"); len(lines) > maxErrorOutputLines {
+		output = strings.Join(lines[len(lines)-maxErrorOutputLines:], "\n")
+	}
+	return &CommandError{
+		Command: subcommand(args),
+		Output:  logging.Redact(output, secrets...),
+		Kind:    classifyOutput(string(stdout) + string(stderr)),
+		Err:     err,
+	}
+}
+
+func (e *CommandError) Error() string {
+	if e.Output == "" {
+		return fmt.Sprintf("git %s failed: %s", e.Command, e.Err)
+	}
+	return fmt.Sprintf("git %s failed: %s: %s", e.Command, e.Err, e.Output)
+}
+
+func (e *CommandError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// subcommand returns the git subcommand in the arguments, skipping the
+// configuration that's passed with -c.
+func subcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" {
+			i++
+			continue
+		}
+		return args[i]
+	}
+	return ""
+}
+
+// The output of git, and git servers, for the kinds of failure, these are
+// matched case insensitively, the output for some failures includes the name of
+// the repository or ref, and is matched with regular expressions.
+var outputKinds = []struct {
+	kind     error
+	patterns []string
+	matches  []*regexp.Regexp
+}{
+	{ErrNoChanges, []string{"nothing to commit", "nothing added to commit", "no changes added to commit"}, nil},
+	{ErrConflict, []string{"non-fast-forward", "(fetch first)", "updates were rejected because", "conflict ("}, nil},
+	{ErrRemoteRejected, []string{"[remote rejected]", "protected branch", "hook declined", "pre-receive hook"}, nil},
+	{ErrAuth, []string{
+		"authentication failed", "could not read username", "could not read password", "terminal prompts disabled",
+		"permission denied (publickey", "permission to ", "access denied", "invalid username or password", "returned error: 401", "returned error: 403",
+		"write access to repository not granted",
+	}, nil},
+	{ErrNotFound, []string{
+		"repository not found", "couldn't find remote ref", "could not find remote branch", "does not appear to be a git repository",
+		"returned error: 404", "unknown revision", "did not match any file(s) known to git", "invalid reference",
+	}, []*regexp.Regexp{
+		regexp.MustCompile(`repository '[^']*' not found`),
+		regexp.MustCompile(`remote branch \S+ not found in upstream`),
+	}},
+}
+
+// classifyOutput returns the kind of failure from the output of git, or nil if
+// it's not known.
+func classifyOutput(output string) error {
+	output = strings.ToLower(output)
+	for _, k := range outputKinds {
+		for _, p := range k.patterns {
+			if strings.Contains(output, p) {
+				return k.kind
+			}
+		}
+		for _, m := range k.matches {
+			if m.MatchString(output) {
+				return k.kind
+			}
+		}
+	}
+	return nil
+}
+
+// ErrorForStatus returns the kind of failure for the HTTP status of a response
+// from a Git hosting service's API, or nil if it's not known.
+func ErrorForStatus(status int) error {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict, http.StatusUnprocessableEntity:
+		return ErrConflict
+	}
+	return nil
+}
+
+// The output of git for failures that are likely to succeed if they're retried,
+// e.g. network failures, and errors from the server, these are matched case
+// insensitively.
+var transientPatterns = []string{
+	"could not resolve host", "failed to connect", "connection timed out", "connection refused", "connection reset",
+	"operation timed out", "the remote end hung up unexpectedly", "early eof", "rpc failed", "unexpected disconnect",
+	"returned error: 429", "returned error: 500", "returned error: 502", "returned error: 503", "returned error: 504",
+}
+
+// IsTransient returns true if the error is a git command that failed in a way
+// that's likely to succeed if it's retried, e.g. the server was unavailable.
+//
+// Commands that were stopped by the context being cancelled aren't transient.
+func IsTransient(err error) bool {
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) || commandErr.Kind != nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	output := strings.ToLower(commandErr.Output)
+	for _, p := range transientPatterns {
+		if strings.Contains(output, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,14 @@
 package git
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
 	"strings"
 	"testing"
+
+	"github.com/rhd-gitops-example/services/test"
 )
 
 func TestCleanURLRemovesTokenFromError(t *testing.T) {
@@ -23,3 +29,123 @@ func TestCleanURLThrowsErrorIfInvalidURL(t *testing.T) {
 		t.Fatalf("did not get an an error cleaning a bad URL, cleaned URL is: %s", cleanedURL)
 	}
 }
+
+func TestWrapGitError(t *testing.T) {
+	cause := &CommandError{Command: "fetch", Output: "fatal: Authentication failed", Kind: ErrAuth, Err: errors.New("exit status 128")}
+	inner := WrapGitError(cause, "failed to clone repository", "https://mytoken@github.com/my-repo")
+	err := WrapGitError(inner, "failed to clone source repository", "https://mytoken@github.com/my-repo")
+
+	want := "failed to clone source repository, error: failed to clone repository, error: git fetch failed: exit status 128: fatal: Authentication failed. repository URL = https://github.com/my-repo"
+	if err.Error() != want {
+		t.Fatalf("got %q, want %q", err, want)
+	}
+	if !errors.Is(err, ErrAuth) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("errors.Is didn't match the kind of error: %s", err)
+	}
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) || commandErr.Command != "fetch" {
+		t.Fatalf("errors.As didn't find the CommandError in %s", err)
+	}
+	if !IsGitError(fmt.Errorf("wrapped: %w", err)) {
+		t.Fatal("IsGitError didn't find the GitError")
+	}
+}
+
+func TestErrorf(t *testing.T) {
+	cause := errors.New("invalid YAML")
+	err := Errorf(ErrNotFound, "did not find %s: %w", "environments/dev", cause)
+
+	if err.Error() != "did not find environments/dev: invalid YAML" {
+		t.Fatalf("got %q", err)
+	}
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, cause) {
+		t.Fatalf("errors.Is didn't match the kind and cause of %s", err)
+	}
+}
+
+func TestClassifyOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		want   error
+	}{
+		{"fatal: Authentication failed for 'https://github.com/my-org/my-repo.git/'", ErrAuth},
+		{"fatal: could not read Username for 'https://github.com': terminal prompts disabled", ErrAuth},
+		{"remote: Permission to my-org/my-repo.git denied to my-user.", ErrAuth},
+		{"remote: Repository not found.\nfatal: repository 'https://github.com/my-org/my-repo.git/' not found", ErrNotFound},
+		{"fatal: couldn't find remote ref refs/heads/unknown", ErrNotFound},
+		{"fatal: repository 'https://example.com/my-org/my-repo.git/' not found", ErrNotFound},
+		{"warning: Could not find remote branch unknown to clone.\nfatal: Remote branch unknown not found in upstream origin", ErrNotFound},
+		{"error: pathspec 'unknown' did not match any file(s) known to git", ErrNotFound},
+		{"gpg: signing failed: No secret key", nil},
+		{"error: gpg failed to sign the data:\ngpg: skipped \"ABCDEF\": key not found", nil},
+		{"error: cannot run gpg: sh: 1: gpg: command not found", nil},
+		{"Error: kustomization.yaml not found", nil},
+		{"On branch master\nnothing to commit, working tree clean", ErrNoChanges},
+		{" ! [rejected]        master -> master (fetch first)\nerror: failed to push some refs", ErrConflict},
+		{" ! [rejected]        master -> master (non-fast-forward)", ErrConflict},
+		{" ! [remote rejected] master -> master (protected branch hook declined)", ErrRemoteRejected},
+		{"fatal: unable to access 'https://github.com/': Could not resolve host: github.com", nil},
+	}
+	for _, tt := range tests {
+		if got := classifyOutput(tt.output); got != tt.want {
+			t.Errorf("classifyOutput(%q) got %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestExecGitReturnsCommandError(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	upstream.token = "my-secret-token"
+
+	_, err := upstream.execGit(upstream.repoPath(), nil, "commit", "-m", "nothing has changed")
+
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) {
+		t.Fatalf("got %#v, want a CommandError", err)
+	}
+	if commandErr.Command != "commit" || !errors.Is(err, ErrNoChanges) {
+		t.Fatalf("got %#v, want a failed commit with no changes", commandErr)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("errors.As didn't find the exec.ExitError in %#v", err)
+	}
+	test.AssertErrorMatch(t, "(?s)git commit failed: exit status 1: .*nothing to commit", err)
+}
+
+func TestPushConflictIsErrConflict(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	r := cloneUpstreamRepository(t, upstream)
+	assertExecGit(t, upstream, upstream.repoPath(), "commit", "--allow-empty", "-m", "upstream commit")
+	assertNoError(t, r.Checkout("master"))
+	assertNoError(t, r.WriteFile(strings.NewReader("conflicting"), "conflict.txt"))
+	assertNoError(t, r.StageFiles("conflict.txt"))
+	assertNoError(t, r.Commit("conflicting commit", &Author{Name: "Test User", Email: "testing@example.com"}))
+
+	err := r.Push("master")
+
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("got %v, want a conflict", err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{newCommandError([]string{"fetch"}, nil, []byte("fatal: unable to access 'https://github.com/': Could not resolve host: github.com"), errors.New("exit status 128")), true},
+		{newCommandError([]string{"push"}, nil, []byte("error: RPC failed; HTTP 502 curl 22 The requested URL returned error: 502\nfatal: the remote end hung up unexpectedly"), errors.New("exit status 1")), true},
+		{newCommandError([]string{"clone"}, nil, []byte("fatal: unable to access 'https://github.com/': Failed to connect to github.com port 443: Connection refused"), context.Canceled), false},
+		{newCommandError([]string{"push"}, nil, []byte(" ! [rejected]        master -> master (fetch first)"), errors.New("exit status 1")), false},
+		{newCommandError([]string{"clone"}, nil, []byte("remote: Repository not found.\nfatal: early EOF"), errors.New("exit status 128")), false},
+		{errors.New("could not resolve host"), false},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%q) got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the file in a service's folder that lists the
+// patterns for files that should not be promoted.
+const IgnoreFile = ".promotionignore"
+
+// Filter selects which of a service's configuration files are promoted.
+//
+// Patterns are globs that are matched against the path of a file relative to
+// the configuration folder, patterns without a "/" are matched against the
+// name of the file in any folder, and patterns ending in "/" match everything
+// in a folder.
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// NewFilter creates and returns a new Filter, or an error if any of the
+// patterns are invalid.
+func NewFilter(include, exclude []string) (*Filter, error) {
+	for _, p := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return &Filter{Include: include, Exclude: exclude}, nil
+}
+
+// Empty returns true if the filter would match every file.
+func (f *Filter) Empty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// Match returns true if the file should be promoted, the file must match one
+// of the include patterns if there are any, and none of the exclude patterns.
+func (f *Filter) Match(name string) bool {
+	if len(f.Include) > 0 && !matchesAny(f.Include, name) {
+		return false
+	}
+	return !matchesAny(f.Exclude, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		p = strings.TrimPrefix(p, "/")
+		if strings.HasSuffix(p, "/") {
+			if strings.HasPrefix(name, p) {
+				return true
+			}
+			continue
+		}
+		target := name
+		if !strings.Contains(p, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIgnoreFile returns the patterns in an IgnoreFile, one per line, blank
+// lines and lines starting with "#" are ignored.
+func ParseIgnoreFile(data []byte) []string {
+	patterns := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// ServiceIgnorePatterns returns the patterns in the IgnoreFile in the service's
+// folder in the repository, if there is one.
+func ServiceIgnorePatterns(r Repo, serviceName, environmentName string) ([]string, error) {
+	ignorePath := path.Join(r.Layout().ServicePath(serviceName, environmentName), IgnoreFile)
+	data, err := r.ReadFile(ignorePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", ignorePath, err)
+	}
+	return ParseIgnoreFile(data), nil
+}
+
+// FilterService wraps a Repo so that Walk skips the configuration files for
+// the service in the environment that don't match the filter.
+func FilterService(r Repo, serviceName, environmentName string, f *Filter) Repo {
+	layout := r.Layout()
+	servicePath := layout.ServicePath(serviceName, environmentName)
+	configPath := layout.ConfigPath(serviceName, environmentName)
+	return &filteredRepo{Repo: r, prefix: strings.TrimPrefix(configPath, path.Dir(servicePath)+"/") + "/", filter: f}
+}
+
+type filteredRepo struct {
+	Repo
+	prefix string
+	filter *Filter
+}
+
+func (r *filteredRepo) Walk(base string, cb func(prefix, name string) error) error {
+	return r.Repo.Walk(base, filterWalk(r.prefix, r.filter, cb))
+}
+
+func filterWalk(filterPrefix string, f *Filter, cb func(prefix, name string) error) func(prefix, name string) error {
+	return func(prefix, name string) error {
+		slashed := filepath.ToSlash(name)
+		if strings.HasPrefix(slashed, filterPrefix) && !f.Match(strings.TrimPrefix(slashed, filterPrefix)) {
+			return nil
+		}
+		return cb(prefix, name)
+	}
+}
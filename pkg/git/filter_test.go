@@ -0,0 +1,83 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterMatch(t *testing.T) {
+	matchTests := []struct {
+		include []string
+		exclude []string
+		name    string
+		want    bool
+	}{
+		{nil, nil, "deployment.yaml", true},
+		{nil, []string{"configmap-env.yaml"}, "configmap-env.yaml", false},
+		{nil, []string{"configmap-env.yaml"}, "overlays/configmap-env.yaml", false},
+		{nil, []string{"*.secret.yaml"}, "db.secret.yaml", false},
+		{nil, []string{"*.secret.yaml"}, "deployment.yaml", true},
+		{nil, []string{"overlays/*.yaml"}, "overlays/patch.yaml", false},
+		{nil, []string{"overlays/*.yaml"}, "patch.yaml", true},
+		{nil, []string{"/overlays/"}, "overlays/nested/patch.yaml", false},
+		{[]string{"*.yaml"}, nil, "README.md", false},
+		{[]string{"*.yaml"}, []string{"kustomization.yaml"}, "kustomization.yaml", false},
+		{[]string{"*.yaml"}, []string{"kustomization.yaml"}, "deployment.yaml", true},
+	}
+
+	for _, tt := range matchTests {
+		f, err := NewFilter(tt.include, tt.exclude)
+		assertNoError(t, err)
+		if got := f.Match(tt.name); got != tt.want {
+			t.Errorf("Match(%s) with include %v and exclude %v got %v, want %v", tt.name, tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestNewFilterWithInvalidPattern(t *testing.T) {
+	_, err := NewFilter(nil, []string{"[config"})
+	if err == nil || err.Error() != `invalid pattern "[config": syntax error in pattern` {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestParseIgnoreFile(t *testing.T) {
+	patterns := ParseIgnoreFile([]byte("# environment specific files\nconfigmap-env.yaml\n\n  *.secret.yaml  \n"))
+
+	want := []string{"configmap-env.yaml", "*.secret.yaml"}
+	if diff := cmp.Diff(want, patterns); diff != "" {
+		t.Fatalf("patterns did not match: %s", diff)
+	}
+}
+
+func TestCopyServiceWithFilter(t *testing.T) {
+	source, cleanupSource := makeLocalRepository(t, map[string]string{
+		"environments/dev/services/service-a/base/config/deployment.yaml":    "kind: Deployment\n",
+		"environments/dev/services/service-a/base/config/configmap-env.yaml": "kind: ConfigMap\n",
+		"environments/dev/services/service-a/.promotionignore":               "configmap-env.yaml\n",
+	})
+	defer cleanupSource()
+	dest, cleanupDest := makeLocalRepository(t, map[string]string{
+		"environments/staging/services/service-a/base/config/configmap-env.yaml": "kind: ConfigMap\n",
+	})
+	defer cleanupDest()
+
+	patterns, err := ServiceIgnorePatterns(source, "service-a", "dev")
+	assertNoError(t, err)
+	f, err := NewFilter(nil, patterns)
+	assertNoError(t, err)
+
+	copied, err := CopyService("service-a", FilterService(source, "service-a", "dev", f), dest, "dev", "staging")
+	assertNoError(t, err)
+	want := []string{"environments/staging/services/service-a/base/config/deployment.yaml"}
+	if diff := cmp.Diff(want, copied); diff != "" {
+		t.Fatalf("copied files did not match: %s", diff)
+	}
+
+	removed, err := PruneService("service-a", FilterService(dest, "service-a", "staging", f), "staging", copied)
+	assertNoError(t, err)
+	if diff := cmp.Diff([]string{}, removed); diff != "" {
+		t.Fatalf("excluded files were removed: %s", diff)
+	}
+}
@@ -0,0 +1,172 @@
+package git
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The installation tokens are refreshed when they have less than this left
+// before they expire, so that they don't expire during a git command or API
+// request.
+const appTokenRefreshMargin = 5 * time.Minute
+
+// GitHubApp authenticates as an installation of a GitHub App, the installation
+// tokens are minted with a JWT signed by the App's private key, and refreshed
+// when they expire.
+//
+// Pull requests created with the installation tokens are authored by the App.
+type GitHubApp struct {
+	AppID          int64
+	InstallationID int64
+	// APIURL is the URL of the GitHub API, e.g. https://api.github.com, or
+	// https://github.example.com/api/v3 for GitHub Enterprise.
+	APIURL     string
+	HTTPClient *http.Client
+
+	key    *rsa.PrivateKey
+	now    func() time.Time
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewGitHubApp creates and returns a GitHubApp for the installation of the
+// App, keyPEM is the PEM encoded private key generated for the App.
+func NewGitHubApp(appID, installationID int64, keyPEM []byte, apiURL string) (*GitHubApp, error) {
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &GitHubApp{
+		AppID:          appID,
+		InstallationID: installationID,
+		APIURL:         strings.TrimSuffix(apiURL, "/"),
+		HTTPClient:     http.DefaultClient,
+		key:            key,
+		now:            time.Now,
+	}, nil
+}
+
+// AppAPIURL returns the URL of the GitHub API for the host, the host is
+// github.com or a GitHub Enterprise server.
+func AppAPIURL(host string) string {
+	if host == "github.com" {
+		return "https://api.github.com"
+	}
+	return "https://" + host + "/api/v3"
+}
+
+// Token returns an installation token, a new token is minted if there's no
+// token or it's about to expire, the request is cancelled with the context.
+func (a *GitHubApp) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && a.now().Add(appTokenRefreshMargin).Before(a.expiry) {
+		return a.token, nil
+	}
+	token, expiry, err := a.mintInstallationToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to create a token for installation %d of GitHub App %d: %w", a.InstallationID, a.AppID, err)
+	}
+	a.token, a.expiry = token, expiry
+	return token, nil
+}
+
+func (a *GitHubApp) mintInstallationToken(ctx context.Context) (string, time.Time, error) {
+	jwt, err := a.jwt()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/app/installations/%d/access_tokens", a.APIURL, a.InstallationID), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	res, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if res.StatusCode != http.StatusCreated {
+		return "", time.Time{}, fmt.Errorf("unexpected status %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	var installationToken struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &installationToken); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse the response: %w", err)
+	}
+	if installationToken.Token == "" {
+		return "", time.Time{}, errors.New("no token in the response")
+	}
+	return installationToken.Token, installationToken.ExpiresAt, nil
+}
+
+// jwt returns a JWT that authenticates as the App, signed with RS256.
+//
+// The issued at time is set in the past to allow for clock drift, and GitHub
+// doesn't accept JWTs that expire more than 10 minutes in the future.
+func (a *GitHubApp) jwt() (string, error) {
+	now := a.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": a.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign the JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey parses a PEM encoded RSA private key, GitHub generates keys
+// in PKCS #1 form, PKCS #8 is also accepted.
+func parsePrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("failed to parse the private key, it's not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("failed to parse the private key, it's not an RSA key")
+	}
+	return rsaKey, nil
+}
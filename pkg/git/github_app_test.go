@@ -0,0 +1,189 @@
+package git
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rhd-gitops-example/services/test"
+)
+
+func TestGitHubAppToken(t *testing.T) {
+	key := mustGenerateKey(t)
+	now := time.Date(2020, time.May, 1, 12, 0, 0, 0, time.UTC)
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method != http.MethodPost || r.URL.Path != "/app/installations/5678/access_tokens" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		claims := assertValidJWT(t, &key.PublicKey, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		want := map[string]int64{"iat": now.Add(-time.Minute).Unix(), "exp": now.Add(9 * time.Minute).Unix(), "iss": 1234}
+		if diff := cmp.Diff(want, claims); diff != "" {
+			t.Errorf("JWT claims don't match: %s", diff)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"installation-token-%d","expires_at":%q}`, requests, now.Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer ts.Close()
+	app, err := NewGitHubApp(1234, 5678, encodeKey(key), ts.URL+"/")
+	assertNoError(t, err)
+	app.now = func() time.Time { return now }
+
+	for _, want := range []string{"installation-token-1", "installation-token-1"} {
+		token, err := app.Token(context.Background())
+		assertNoError(t, err)
+		if token != want {
+			t.Fatalf("got token %q, want %q", token, want)
+		}
+	}
+
+	// The token is refreshed when it's about to expire.
+	now = now.Add(56 * time.Minute)
+	token, err := app.Token(context.Background())
+	assertNoError(t, err)
+	if token != "installation-token-2" {
+		t.Fatalf("got token %q, want it to be refreshed", token)
+	}
+}
+
+func TestGitHubAppTokenWithFailedRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message":"A JSON web token could not be decoded"}`)
+	}))
+	defer ts.Close()
+	app, err := NewGitHubApp(1234, 5678, encodeKey(mustGenerateKey(t)), ts.URL)
+	assertNoError(t, err)
+
+	_, err = app.Token(context.Background())
+	test.AssertErrorMatch(t, "failed to create a token for installation 5678 of GitHub App 1234: unexpected status 401 Unauthorized", err)
+}
+
+func TestGitHubAppTokenWithCancelledContext(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+	app, err := NewGitHubApp(1234, 5678, encodeKey(mustGenerateKey(t)), ts.URL)
+	assertNoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = app.Token(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the context's error", err)
+	}
+}
+
+func TestNewGitHubAppWithInvalidKey(t *testing.T) {
+	_, err := NewGitHubApp(1234, 5678, []byte("not a key"), "https://api.github.com")
+	test.AssertErrorMatch(t, "not PEM encoded", err)
+}
+
+func TestNewGitHubAppWithPKCS8Key(t *testing.T) {
+	key := mustGenerateKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assertNoError(t, err)
+
+	app, err := NewGitHubApp(1234, 5678, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), "https://api.github.com")
+	assertNoError(t, err)
+	if app.key.N.Cmp(key.N) != 0 {
+		t.Fatal("the parsed key doesn't match")
+	}
+}
+
+func TestAppAPIURL(t *testing.T) {
+	for host, want := range map[string]string{
+		"github.com":         "https://api.github.com",
+		"github.example.com": "https://github.example.com/api/v3",
+	} {
+		if got := AppAPIURL(host); got != want {
+			t.Errorf("AppAPIURL(%q) got %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestTokensPreferGitHubApps(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"installation-token","expires_at":%q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer ts.Close()
+	app, err := NewGitHubApp(1234, 5678, encodeKey(mustGenerateKey(t)), ts.URL)
+	assertNoError(t, err)
+	tokens := &Tokens{
+		Default: "default-token",
+		Hosts:   map[string]string{"github.com": "github-token"},
+		Apps:    map[string]*GitHubApp{"github.com": app},
+	}
+
+	for repoURL, want := range map[string]string{
+		"https://github.com/testing/testing.git":         "installation-token",
+		"https://gitlab.example.com/testing/testing.git": "default-token",
+	} {
+		got, err := tokens.Token(context.Background(), repoURL)
+		assertNoError(t, err)
+		if got != want {
+			t.Errorf("Token(%q) got %q, want %q", repoURL, got, want)
+		}
+	}
+}
+
+func mustGenerateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assertNoError(t, err)
+	return key
+}
+
+func encodeKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// assertValidJWT verifies the RS256 signature of the JWT and returns its
+// claims.
+func assertValidJWT(t *testing.T, key *rsa.PublicKey, jwt string) map[string]int64 {
+	t.Helper()
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("invalid JWT %q", jwt)
+	}
+	header := map[string]string{}
+	mustDecodeJWTPart(t, parts[0], &header)
+	if diff := cmp.Diff(map[string]string{"alg": "RS256", "typ": "JWT"}, header); diff != "" {
+		t.Fatalf("JWT header doesn't match: %s", diff)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assertNoError(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("invalid JWT signature: %s", err)
+	}
+	claims := map[string]int64{}
+	mustDecodeJWTPart(t, parts[1], &claims)
+	return claims
+}
+
+func mustDecodeJWTPart(t *testing.T, part string, v interface{}) {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	assertNoError(t, err)
+	assertNoError(t, json.Unmarshal(data, v))
+}
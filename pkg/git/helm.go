@@ -0,0 +1,172 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultHelmValues are the keys in a chart's values.yaml that are promoted if
+// none are provided.
+var DefaultHelmValues = []string{"image.tag"}
+
+// chartKeys are the fields in Chart.yaml that are promoted.
+var chartKeys = []string{"version", "appVersion"}
+
+// CopyHelmValues takes the name of a service, and for each Helm chart in the
+// service's configuration in the Source, updates the chart version, and the
+// named keys in the chart's values.yaml, in the Destination.
+//
+// The rest of the destination's Chart.yaml and values.yaml are kept, including
+// comments and the order of keys.
+//
+// Returns the list of files that were changed, and possibly an error.
+func CopyHelmValues(serviceName string, source Source, dest Repo, sourceEnvironment, destinationEnvironment string, keys []string) ([]string, error) {
+	valuePaths := [][]interface{}{}
+	for _, k := range keys {
+		segments, err := parseValuePath(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid values key %q: %w", k, err)
+		}
+		valuePaths = append(valuePaths, segments)
+	}
+
+	sourceLayout := layoutOf(source)
+	filePath := sourceLayout.ServicePath(serviceName, sourceEnvironment)
+	configPath := sourceLayout.ConfigPath(serviceName, sourceEnvironment)
+	changed := []string{}
+	found := false
+	err := source.Walk(filePath, func(prefix, name string) error {
+		repoPath := path.Join(path.Dir(filePath), name)
+		if path.Base(name) != "Chart.yaml" || !sourceLayout.pathValidForPromotion(serviceName, repoPath, sourceEnvironment) {
+			return nil
+		}
+		found = true
+		sourceDir := filepath.Dir(filepath.Join(prefix, name))
+		destDir := path.Dir(path.Join(dest.Layout().ConfigPath(serviceName, destinationEnvironment), strings.TrimPrefix(repoPath, configPath+"/")))
+
+		chartPaths := [][]interface{}{}
+		for _, k := range chartKeys {
+			chartPaths = append(chartPaths, []interface{}{k})
+		}
+		updated, err := copyHelmFile(filepath.Join(sourceDir, "Chart.yaml"), dest, path.Join(destDir, "Chart.yaml"), chartPaths)
+		if err != nil {
+			return err
+		}
+		if updated {
+			changed = append(changed, path.Join(destDir, "Chart.yaml"))
+		}
+		updated, err = copyHelmFile(filepath.Join(sourceDir, "values.yaml"), dest, path.Join(destDir, "values.yaml"), valuePaths)
+		if err != nil {
+			return err
+		}
+		if updated {
+			changed = append(changed, path.Join(destDir, "values.yaml"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, Errorf(ErrNotFound, "no Helm charts found for service %s in %s", serviceName, filePath)
+	}
+	return changed, nil
+}
+
+// copyHelmFile copies the values at the paths from the source file to the file
+// in the destination, returning true if the destination was changed.
+//
+// A missing source values.yaml is not an error, but the destination chart must
+// exist.
+func copyHelmFile(sourcePath string, dest Repo, destPath string, paths [][]interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(sourcePath)
+	if err != nil {
+		if os.IsNotExist(err) && path.Base(destPath) == "values.yaml" {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read %s: %w", sourcePath, err)
+	}
+	var source yaml.Node
+	if err := yaml.Unmarshal(data, &source); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", sourcePath, err)
+	}
+	if len(source.Content) == 0 {
+		return false, nil
+	}
+
+	data, err = dest.ReadFile(destPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, Errorf(ErrNotFound, "%s not found in the destination, the chart must be promoted with the copy strategy first", destPath)
+		}
+		return false, fmt.Errorf("failed to read %s: %w", destPath, err)
+	}
+	docs, err := decodeDocuments(data)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", destPath, err)
+	}
+	if len(docs) == 0 {
+		docs = []*yaml.Node{{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}}
+	}
+
+	updated := false
+	for _, segments := range paths {
+		value := lookupValuePath(source.Content[0], segments)
+		if value == nil {
+			continue
+		}
+		if setValuePath(docs[0].Content[0], segments, value) {
+			updated = true
+		}
+	}
+	if !updated {
+		return false, nil
+	}
+	out, err := encodeDocuments(docs)
+	if err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", destPath, err)
+	}
+	return true, dest.WriteFile(bytes.NewReader(out), destPath)
+}
+
+// setValuePath sets the node at the path to the value, creating any missing
+// keys along the way, returning true if the node was changed.
+//
+// Missing sequence entries are not created.
+func setValuePath(n *yaml.Node, segments []interface{}, value *yaml.Node) bool {
+	for i, s := range segments {
+		var next *yaml.Node
+		switch v := s.(type) {
+		case string:
+			if n.Kind != yaml.MappingNode {
+				return false
+			}
+			next = mappingValue(n, v)
+			if next == nil {
+				next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				if i == len(segments)-1 {
+					next = &yaml.Node{}
+				}
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, next)
+			}
+		case int:
+			if n.Kind != yaml.SequenceNode || v < 0 || v >= len(n.Content) {
+				return false
+			}
+			next = n.Content[v]
+		}
+		n = next
+	}
+	if nodesEqual(n, value) {
+		return false
+	}
+	replaceNode(n, value)
+	return true
+}
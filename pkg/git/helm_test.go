@@ -0,0 +1,86 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCopyHelmValues(t *testing.T) {
+	source, cleanupSource := makeLocalRepository(t, map[string]string{
+		"environments/dev/services/service-a/base/config/chart/Chart.yaml": "apiVersion: v2\nname: service-a\nversion: 1.2.0\nappVersion: v2\n",
+		"environments/dev/services/service-a/base/config/chart/values.yaml": `replicaCount: 1
+image:
+  repository: quay.io/example/service-a
+  tag: v2
+resources:
+  limits:
+    memory: 128Mi
+`,
+	})
+	defer cleanupSource()
+	dest, cleanupDest := makeLocalRepository(t, map[string]string{
+		"environments/staging/services/service-a/base/config/chart/Chart.yaml": "apiVersion: v2\nname: service-a\n# bumped on every promotion\nversion: 1.1.0\nappVersion: v1\n",
+		"environments/staging/services/service-a/base/config/chart/values.yaml": `# staging runs more replicas
+replicaCount: 3
+image:
+  repository: quay.io/example/service-a
+  tag: v1 # promoted from dev
+`,
+	})
+	defer cleanupDest()
+
+	changed, err := CopyHelmValues("service-a", source, dest, "dev", "staging", []string{"image.tag", "resources.limits"})
+	assertNoError(t, err)
+
+	want := []string{
+		"environments/staging/services/service-a/base/config/chart/Chart.yaml",
+		"environments/staging/services/service-a/base/config/chart/values.yaml",
+	}
+	if diff := cmp.Diff(want, changed); diff != "" {
+		t.Fatalf("changed files did not match: %s", diff)
+	}
+	assertRepoFileContents(t, dest, "environments/staging/services/service-a/base/config/chart/Chart.yaml", "apiVersion: v2\nname: service-a\n# bumped on every promotion\nversion: 1.2.0\nappVersion: v2\n")
+	assertRepoFileContents(t, dest, "environments/staging/services/service-a/base/config/chart/values.yaml", `# staging runs more replicas
+replicaCount: 3
+image:
+  repository: quay.io/example/service-a
+  tag: v2 # promoted from dev
+resources:
+  limits:
+    memory: 128Mi
+`)
+}
+
+func TestCopyHelmValuesWithMissingChart(t *testing.T) {
+	source, cleanupSource := makeLocalRepository(t, map[string]string{
+		"environments/dev/services/service-a/base/config/Chart.yaml": "apiVersion: v2\nname: service-a\nversion: 1.2.0\n",
+	})
+	defer cleanupSource()
+	dest, cleanupDest := makeLocalRepository(t, map[string]string{
+		"environments/staging/services/service-a/base/config/deployment.yaml": "kind: Deployment\n",
+	})
+	defer cleanupDest()
+
+	_, err := CopyHelmValues("service-a", source, dest, "dev", "staging", DefaultHelmValues)
+	want := "environments/staging/services/service-a/base/config/Chart.yaml not found in the destination, the chart must be promoted with the copy strategy first"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %s", err, want)
+	}
+}
+
+func TestCopyHelmValuesWithNoCharts(t *testing.T) {
+	files := map[string]string{
+		"environments/dev/services/service-a/base/config/deployment.yaml": "kind: Deployment\n",
+	}
+	source, cleanupSource := makeLocalRepository(t, files)
+	defer cleanupSource()
+	dest, cleanupDest := makeLocalRepository(t, files)
+	defer cleanupDest()
+
+	_, err := CopyHelmValues("service-a", source, dest, "dev", "dev", DefaultHelmValues)
+	want := "no Helm charts found for service service-a in environments/dev/services/service-a"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %s", err, want)
+	}
+}
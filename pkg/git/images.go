@@ -0,0 +1,229 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CopyImages takes the name of a service, and updates the images used by the
+// service in the Destination to match those in the Source.
+//
+// Rather than copying whole files, only the `images` entries in kustomization
+// files, and the `image` fields of containers, are changed in the destination,
+// so any environment specific configuration is kept.
+//
+// Returns the list of files that were changed, and possibly an error.
+func CopyImages(serviceName string, source Source, dest Repo, sourceEnvironment, destinationEnvironment string) ([]string, error) {
+	images, err := sourceImages(serviceName, source, sourceEnvironment)
+	if err != nil {
+		return nil, err
+	}
+	return updateImages(serviceName, dest, destinationEnvironment, images)
+}
+
+// UpdateImage takes the name of a service, and updates the images used by the
+// service in the Repo that are for the same image as the reference, in
+// container image fields and kustomize images entries.
+//
+// Returns the list of files that were changed, and possibly an error.
+func UpdateImage(serviceName string, r Repo, environmentName, ref string) ([]string, error) {
+	images := &imageSet{kustomize: map[string]*yaml.Node{}, containers: map[string]string{imageName(ref): ref}}
+	return updateImages(serviceName, r, environmentName, images)
+}
+
+// ParseImage splits an image reference into the name, tag and digest, the tag
+// and digest can be empty.
+func ParseImage(ref string) (string, string, string) {
+	tag, digest := imageTagAndDigest(ref)
+	return imageName(ref), tag, digest
+}
+
+// imageSet records the images used by a service.
+//
+// The kustomize entries are keyed by the image name they apply to, and the
+// container images by the name of the image without a tag or digest.
+type imageSet struct {
+	kustomize  map[string]*yaml.Node
+	containers map[string]string
+}
+
+func sourceImages(serviceName string, source Source, environmentName string) (*imageSet, error) {
+	images := &imageSet{kustomize: map[string]*yaml.Node{}, containers: map[string]string{}}
+	layout := layoutOf(source)
+	filePath := layout.ServicePath(serviceName, environmentName)
+	err := source.Walk(filePath, func(prefix, name string) error {
+		if !layout.pathValidForPromotion(serviceName, path.Join(path.Dir(filePath), name), environmentName) || !isYAML(name) {
+			return nil
+		}
+		sourcePath := filepath.Join(prefix, name)
+		data, err := ioutil.ReadFile(sourcePath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", sourcePath, err)
+		}
+		docs, err := decodeDocuments(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", sourcePath, err)
+		}
+		for _, doc := range docs {
+			for _, entry := range kustomizeImages(name, doc) {
+				images.kustomize[scalarValue(entry, "name")] = entry
+			}
+			for _, image := range containerImages(doc) {
+				images.containers[imageName(image.Value)] = image.Value
+			}
+		}
+		return nil
+	})
+	return images, err
+}
+
+// updateImages changes the images in the service's configuration in the
+// repository to match the images.
+func updateImages(serviceName string, r Repo, environmentName string, images *imageSet) ([]string, error) {
+	layout := r.Layout()
+	filePath := layout.ServicePath(serviceName, environmentName)
+	changed := []string{}
+	err := r.Walk(filePath, func(prefix, name string) error {
+		destPath := path.Join(path.Dir(filePath), name)
+		if !layout.pathValidForPromotion(serviceName, destPath, environmentName) || !isYAML(name) {
+			return nil
+		}
+		data, err := r.ReadFile(destPath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", destPath, err)
+		}
+		docs, err := decodeDocuments(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", destPath, err)
+		}
+		updated := false
+		for _, doc := range docs {
+			for _, entry := range kustomizeImages(name, doc) {
+				if images.updateKustomizeEntry(entry) {
+					updated = true
+				}
+			}
+			for _, image := range containerImages(doc) {
+				if ref, ok := images.containers[imageName(image.Value)]; ok && ref != image.Value {
+					image.Value = ref
+					updated = true
+				}
+			}
+		}
+		if !updated {
+			return nil
+		}
+		out, err := encodeDocuments(docs)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", destPath, err)
+		}
+		if err := r.WriteFile(bytes.NewReader(out), destPath); err != nil {
+			return err
+		}
+		changed = append(changed, destPath)
+		return nil
+	})
+	return changed, err
+}
+
+// updateKustomizeEntry updates a kustomize images entry, either from the
+// entry with the same name, or from a container image that the entry applies
+// to.
+func (s *imageSet) updateKustomizeEntry(entry *yaml.Node) bool {
+	if src, ok := s.kustomize[scalarValue(entry, "name")]; ok {
+		updated := false
+		for _, key := range []string{"newName", "newTag", "digest"} {
+			if setScalarValue(entry, key, scalarValue(src, key)) {
+				updated = true
+			}
+		}
+		return updated
+	}
+	name := scalarValue(entry, "newName")
+	if name == "" {
+		name = scalarValue(entry, "name")
+	}
+	ref, ok := s.containers[name]
+	if !ok {
+		return false
+	}
+	tag, digest := imageTagAndDigest(ref)
+	updatedTag := setScalarValue(entry, "newTag", tag)
+	updatedDigest := setScalarValue(entry, "digest", digest)
+	return updatedTag || updatedDigest
+}
+
+// kustomizeImages returns the entries in the images list of a kustomization
+// file.
+func kustomizeImages(filename string, doc *yaml.Node) []*yaml.Node {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	base := strings.ToLower(path.Base(filename))
+	if scalarValue(root, "kind") != "Kustomization" && base != "kustomization.yaml" && base != "kustomization.yml" {
+		return nil
+	}
+	images := mappingValue(root, "images")
+	if images == nil || images.Kind != yaml.SequenceNode {
+		return nil
+	}
+	entries := []*yaml.Node{}
+	for _, entry := range images.Content {
+		if entry.Kind == yaml.MappingNode && scalarValue(entry, "name") != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// containerImages returns the image value nodes for every container and init
+// container in the document, wherever they are in the resource.
+func containerImages(doc *yaml.Node) []*yaml.Node {
+	images := []*yaml.Node{}
+	walkNodes(doc, func(n *yaml.Node) {
+		for _, key := range []string{"containers", "initContainers"} {
+			containers := mappingValue(n, key)
+			if containers == nil || containers.Kind != yaml.SequenceNode {
+				continue
+			}
+			for _, c := range containers.Content {
+				if image := mappingValue(c, "image"); image != nil && image.Kind == yaml.ScalarNode {
+					images = append(images, image)
+				}
+			}
+		}
+	})
+	return images
+}
+
+// imageName returns the name of an image reference, without the tag or
+// digest, e.g. quay.io/org/image:v1 is quay.io/org/image.
+func imageName(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+// imageTagAndDigest returns the tag and digest from an image reference, either
+// can be empty.
+func imageTagAndDigest(ref string) (string, string) {
+	var digest string
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref, digest = ref[:i], ref[i+1:]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[i+1:], digest
+	}
+	return "", digest
+}
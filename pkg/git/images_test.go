@@ -0,0 +1,188 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const stagingDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: service-a
+spec:
+  # staging runs more replicas than dev
+  replicas: 3
+  template:
+    spec:
+      initContainers:
+        - name: setup
+          image: quay.io/example/setup:v1
+      containers:
+        - name: service-a
+          image: quay.io/example/service-a:v1
+          resources:
+            limits:
+              memory: 512Mi
+        - name: sidecar
+          image: quay.io/example/sidecar:v1
+`
+
+func TestCopyImages(t *testing.T) {
+	source, cleanupSource := makeLocalRepository(t, map[string]string{
+		"environments/dev/services/service-a/base/config/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: 1
+  template:
+    spec:
+      initContainers:
+      - name: setup
+        image: quay.io/example/setup:v2
+      containers:
+      - name: service-a
+        image: quay.io/example/service-a@sha256:abcdef
+`,
+		"environments/dev/services/service-a/base/config/kustomization.yaml": `images:
+- name: service-b
+  newName: quay.io/example/service-b
+  newTag: v2
+`,
+	})
+	defer cleanupSource()
+	dest, cleanupDest := makeLocalRepository(t, map[string]string{
+		"environments/staging/services/service-a/base/config/deployment.yaml": stagingDeployment,
+		"environments/staging/services/service-a/base/config/kustomization.yaml": `resources:
+- deployment.yaml
+images:
+- name: service-b
+  newName: quay.io/example/service-b
+  newTag: v1
+  digest: sha256:123456
+- name: quay.io/example/service-a
+  newTag: v1
+`,
+		"environments/staging/services/service-a/base/config/configmap.yaml": "apiVersion: v1\nkind: ConfigMap\n",
+	})
+	defer cleanupDest()
+
+	changed, err := CopyImages("service-a", source, dest, "dev", "staging")
+	assertNoError(t, err)
+
+	want := []string{
+		"environments/staging/services/service-a/base/config/deployment.yaml",
+		"environments/staging/services/service-a/base/config/kustomization.yaml",
+	}
+	if diff := cmp.Diff(want, changed); diff != "" {
+		t.Fatalf("changed files did not match: %s", diff)
+	}
+
+	assertRepoFileContents(t, dest, "environments/staging/services/service-a/base/config/deployment.yaml", `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: service-a
+spec:
+  # staging runs more replicas than dev
+  replicas: 3
+  template:
+    spec:
+      initContainers:
+        - name: setup
+          image: quay.io/example/setup:v2
+      containers:
+        - name: service-a
+          image: quay.io/example/service-a@sha256:abcdef
+          resources:
+            limits:
+              memory: 512Mi
+        - name: sidecar
+          image: quay.io/example/sidecar:v1
+`)
+	assertRepoFileContents(t, dest, "environments/staging/services/service-a/base/config/kustomization.yaml", `resources:
+  - deployment.yaml
+images:
+  - name: service-b
+    newName: quay.io/example/service-b
+    newTag: v2
+  - name: quay.io/example/service-a
+    digest: sha256:abcdef
+`)
+}
+
+func TestCopyImagesWithNoChanges(t *testing.T) {
+	files := map[string]string{
+		"environments/dev/services/service-a/base/config/deployment.yaml": stagingDeployment,
+	}
+	source, cleanupSource := makeLocalRepository(t, files)
+	defer cleanupSource()
+	dest, cleanupDest := makeLocalRepository(t, files)
+	defer cleanupDest()
+
+	changed, err := CopyImages("service-a", source, dest, "dev", "dev")
+	assertNoError(t, err)
+
+	if diff := cmp.Diff([]string{}, changed); diff != "" {
+		t.Fatalf("changed files did not match: %s", diff)
+	}
+}
+
+func TestImageName(t *testing.T) {
+	imageTests := []struct {
+		ref        string
+		wantName   string
+		wantTag    string
+		wantDigest string
+	}{
+		{"nginx", "nginx", "", ""},
+		{"nginx:1.19", "nginx", "1.19", ""},
+		{"quay.io/example/image:v1", "quay.io/example/image", "v1", ""},
+		{"localhost:5000/example/image", "localhost:5000/example/image", "", ""},
+		{"localhost:5000/example/image:v1@sha256:abcdef", "localhost:5000/example/image", "v1", "sha256:abcdef"},
+		{"quay.io/example/image@sha256:abcdef", "quay.io/example/image", "", "sha256:abcdef"},
+	}
+
+	for _, tt := range imageTests {
+		if n := imageName(tt.ref); n != tt.wantName {
+			t.Errorf("imageName(%s) got %s, want %s", tt.ref, n, tt.wantName)
+		}
+		tag, digest := imageTagAndDigest(tt.ref)
+		if tag != tt.wantTag || digest != tt.wantDigest {
+			t.Errorf("imageTagAndDigest(%s) got %s and %s, want %s and %s", tt.ref, tag, digest, tt.wantTag, tt.wantDigest)
+		}
+	}
+}
+
+func assertRepoFileContents(t *testing.T, r *Repository, name, want string) {
+	t.Helper()
+	contents, err := r.ReadFile(name)
+	assertNoError(t, err)
+	if diff := cmp.Diff(want, string(contents)); diff != "" {
+		t.Fatalf("contents of %s did not match: %s", name, diff)
+	}
+}
+
+func TestUpdateImage(t *testing.T) {
+	dest, cleanup := makeLocalRepository(t, map[string]string{
+		"environments/staging/services/service-a/base/config/deployment.yaml": stagingDeployment,
+		"environments/staging/services/service-a/base/config/kustomization.yaml": `images:
+- name: quay.io/example/sidecar
+  newTag: v1
+`,
+	})
+	defer cleanup()
+
+	changed, err := UpdateImage("service-a", dest, "staging", "quay.io/example/sidecar@sha256:abcdef")
+	assertNoError(t, err)
+
+	want := []string{
+		"environments/staging/services/service-a/base/config/deployment.yaml",
+		"environments/staging/services/service-a/base/config/kustomization.yaml",
+	}
+	if diff := cmp.Diff(want, changed); diff != "" {
+		t.Fatalf("changed files did not match: %s", diff)
+	}
+	assertRepoFileContents(t, dest, "environments/staging/services/service-a/base/config/kustomization.yaml", `images:
+  - name: quay.io/example/sidecar
+    digest: sha256:abcdef
+`)
+}
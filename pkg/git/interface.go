@@ -27,11 +27,17 @@ type Repo interface {
 	Clone() error
 	Checkout(branch string) error
 	CheckoutAndCreate(branch string) error
+	CheckoutRef(ref, branch string) error
 	DirectoriesUnderPath(path string) ([]os.FileInfo, error)
 	GetUniqueEnvironmentFolder() (string, error)
+	Layout() *Layout
 	GetCommitID() string
+	ReadFile(name string) ([]byte, error)
+	RemoveFile(name string) error
 	StageFiles(filenames ...string) error
 	Commit(msg string, author *Author) error
 	Push(branch string) error
+	Rebase(branch string) error
 	DeleteCache() error
+	Release() error
 }
@@ -0,0 +1,220 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LayoutFile is the name of the file in the root of a repository that
+// configures the layout of the repository.
+const LayoutFile = ".promotion-layout.yaml"
+
+const (
+	envPlaceholder     = "{env}"
+	servicePlaceholder = "{service}"
+)
+
+// Layout describes where the configuration for services is in a repository.
+//
+// Service is a path template for the folder for a service in an environment,
+// with {env} and {service} placeholders, and Config is the folder under the
+// service's folder with the files that are promoted, this can be empty if all
+// the files in the service's folder are promoted.
+type Layout struct {
+	Service string `yaml:"service"`
+	Config  string `yaml:"config"`
+}
+
+// DefaultLayout is the environments/<env>/services/<service>/base/config
+// layout.
+var DefaultLayout = &Layout{Service: "environments/{env}/services/{service}", Config: "base/config"}
+
+// Layouts are the preset layouts that can be selected by name.
+var Layouts = map[string]*Layout{
+	"default":  DefaultLayout,
+	"apps":     {Service: "apps/{service}/overlays/{env}"},
+	"clusters": {Service: "clusters/{env}/{service}"},
+}
+
+// ParseLayout parses a LayoutFile, this can either select a preset e.g.
+//
+//	preset: apps
+//
+// or provide the templates e.g.
+//
+//	service: clusters/{env}/{service}
+//	config: config
+func ParseLayout(data []byte) (*Layout, error) {
+	var parsed struct {
+		Preset string `yaml:"preset"`
+		Layout `yaml:",inline"`
+	}
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+	if parsed.Preset != "" {
+		l, ok := Layouts[parsed.Preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown layout preset %q", parsed.Preset)
+		}
+		return l, nil
+	}
+	l := &Layout{Service: strings.Trim(parsed.Service, "/"), Config: strings.Trim(parsed.Config, "/")}
+	return l, l.Validate()
+}
+
+// Validate returns an error if the layout's service template doesn't have
+// exactly one {env} and one {service} placeholder, each as a whole path
+// segment.
+func (l *Layout) Validate() error {
+	envs, services := 0, 0
+	for _, s := range strings.Split(l.Service, "/") {
+		switch {
+		case s == envPlaceholder:
+			envs++
+		case s == servicePlaceholder:
+			services++
+		case strings.Contains(s, "{"):
+			return fmt.Errorf("invalid layout %q, placeholders must be whole path segments", l.Service)
+		}
+	}
+	if envs != 1 || services != 1 {
+		return fmt.Errorf("invalid layout %q, must have one %s and one %s", l.Service, envPlaceholder, servicePlaceholder)
+	}
+	return nil
+}
+
+// ServicePath returns the path to the folder for the service in the
+// environment.
+func (l *Layout) ServicePath(serviceName, environmentName string) string {
+	return strings.NewReplacer(envPlaceholder, environmentName, servicePlaceholder, serviceName).Replace(l.Service)
+}
+
+// ConfigPath returns the path to the folder with the service's files that are
+// promoted.
+func (l *Layout) ConfigPath(serviceName, environmentName string) string {
+	return path.Join(l.ServicePath(serviceName, environmentName), l.Config)
+}
+
+// pathValidForPromotion returns true if the path is in the service's
+// configuration folder, only these files are promoted.
+//
+// The PromotionValuesFile and IgnoreFile in the service's folder belong to the
+// environment, so they're never promoted, even if the layout has no
+// configuration folder.
+func (l *Layout) pathValidForPromotion(serviceName, filePath, environmentName string) bool {
+	servicePath := l.ServicePath(serviceName, environmentName)
+	if filePath == path.Join(servicePath, PromotionValuesFile) || filePath == path.Join(servicePath, IgnoreFile) {
+		return false
+	}
+	return strings.HasPrefix(filePath, l.ConfigPath(serviceName, environmentName)+"/")
+}
+
+// root returns the folder in the repository that contains all the
+// environments and services, this is the part of the service template before
+// any placeholders.
+func (l *Layout) root() string {
+	segments := strings.Split(l.Service, "/")
+	for i, s := range segments {
+		if s == envPlaceholder || s == servicePlaceholder {
+			segments = segments[:i]
+			break
+		}
+	}
+	if len(segments) == 0 {
+		return "."
+	}
+	return path.Join(segments...)
+}
+
+// Environments returns the names of the environments in the repository.
+func (l *Layout) Environments(r Repo) ([]string, error) {
+	segments := strings.Split(l.Service, "/")
+	for i, s := range segments {
+		if s == envPlaceholder {
+			segments = segments[:i+1]
+			break
+		}
+	}
+	return l.expand(r, segments, nil, envPlaceholder)
+}
+
+// Services returns the names of the services in an environment in the
+// repository.
+func (l *Layout) Services(r Repo, environmentName string) ([]string, error) {
+	return l.expand(r, strings.Split(l.Service, "/"), map[string]string{envPlaceholder: environmentName}, servicePlaceholder)
+}
+
+// expand finds the folders in the repository that match the path segments,
+// with the values for the bound placeholders, and returns the sorted values
+// found for the placeholder.
+//
+// If a folder doesn't exist before any placeholders have been expanded, an
+// os.PathError is returned with the path in the repository.
+func (l *Layout) expand(r Repo, segments []string, bound map[string]string, placeholder string) ([]string, error) {
+	found := map[string]bool{}
+	var walk func(i int, dir string, values map[string]string, expanded bool) error
+	walk = func(i int, dir string, values map[string]string, expanded bool) error {
+		if i == len(segments) {
+			found[values[placeholder]] = true
+			return nil
+		}
+		s := segments[i]
+		if v, ok := bound[s]; ok {
+			s = v
+		}
+		isPlaceholder := s == envPlaceholder || s == servicePlaceholder
+		if !isPlaceholder && i < len(segments)-1 {
+			return walk(i+1, path.Join(dir, s), values, expanded)
+		}
+		dirs, err := r.DirectoriesUnderPath(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				if expanded {
+					return nil
+				}
+				return &os.PathError{Op: "open", Path: dir, Err: os.ErrNotExist}
+			}
+			return err
+		}
+		for _, d := range dirs {
+			if !isPlaceholder && d.Name() != s {
+				continue
+			}
+			next := values
+			if isPlaceholder {
+				next = map[string]string{s: d.Name()}
+				for k, v := range values {
+					next[k] = v
+				}
+			}
+			if err := walk(i+1, path.Join(dir, d.Name()), next, expanded || isPlaceholder); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(0, "", bound, false); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// layoutOf returns the layout of a Source or Destination, if it's a Repo, or
+// the default layout.
+func layoutOf(v interface{}) *Layout {
+	if l, ok := v.(interface{ Layout() *Layout }); ok {
+		return l.Layout()
+	}
+	return DefaultLayout
+}
@@ -0,0 +1,152 @@
+package git
+
+import (
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLayout(t *testing.T) {
+	layoutTests := []struct {
+		data    string
+		want    *Layout
+		wantErr string
+	}{
+		{"preset: apps\n", Layouts["apps"], ""},
+		{"service: /clusters/{env}/{service}/\nconfig: config\n", &Layout{Service: "clusters/{env}/{service}", Config: "config"}, ""},
+		{"preset: unknown\n", nil, `unknown layout preset "unknown"`},
+		{"service: clusters/{env}\n", nil, `invalid layout "clusters/{env}", must have one {env} and one {service}`},
+		{"service: clusters/{env}-{service}\n", nil, `invalid layout "clusters/{env}-{service}", placeholders must be whole path segments`},
+	}
+
+	for _, tt := range layoutTests {
+		l, err := ParseLayout([]byte(tt.data))
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParseLayout(%q) got error %v, want %s", tt.data, err, tt.wantErr)
+			}
+			continue
+		}
+		assertNoError(t, err)
+		if diff := cmp.Diff(tt.want, l); diff != "" {
+			t.Errorf("ParseLayout(%q) did not match: %s", tt.data, diff)
+		}
+	}
+}
+
+func TestLayoutPaths(t *testing.T) {
+	pathTests := []struct {
+		layout      *Layout
+		wantService string
+		wantConfig  string
+	}{
+		{DefaultLayout, "environments/dev/services/service-a", "environments/dev/services/service-a/base/config"},
+		{Layouts["apps"], "apps/service-a/overlays/dev", "apps/service-a/overlays/dev"},
+		{Layouts["clusters"], "clusters/dev/service-a", "clusters/dev/service-a"},
+	}
+
+	for _, tt := range pathTests {
+		if p := tt.layout.ServicePath("service-a", "dev"); p != tt.wantService {
+			t.Errorf("ServicePath() for %s got %s, want %s", tt.layout.Service, p, tt.wantService)
+		}
+		if p := tt.layout.ConfigPath("service-a", "dev"); p != tt.wantConfig {
+			t.Errorf("ConfigPath() for %s got %s, want %s", tt.layout.Service, p, tt.wantConfig)
+		}
+	}
+}
+
+func TestRepositoryWithAppsLayout(t *testing.T) {
+	r, cleanup := makeLocalRepository(t, map[string]string{
+		LayoutFile: "preset: apps\n",
+		"apps/service-a/overlays/dev/deployment.yaml":     "kind: Deployment\n",
+		"apps/service-a/overlays/staging/deployment.yaml": "kind: Deployment\n",
+		"apps/service-b/overlays/dev/deployment.yaml":     "kind: Deployment\n",
+		"apps/service-b/base/deployment.yaml":             "kind: Deployment\n",
+	})
+	defer cleanup()
+
+	envs, err := r.Layout().Environments(r)
+	assertNoError(t, err)
+	if diff := cmp.Diff([]string{"dev", "staging"}, envs); diff != "" {
+		t.Fatalf("environments did not match: %s", diff)
+	}
+	services, err := r.Layout().Services(r, "staging")
+	assertNoError(t, err)
+	if diff := cmp.Diff([]string{"service-a"}, services); diff != "" {
+		t.Fatalf("services did not match: %s", diff)
+	}
+	result, err := ValidateRepository(r)
+	assertNoError(t, err)
+	assertNoError(t, result.Err())
+
+	_, err = r.GetUniqueEnvironmentFolder()
+	if err == nil || err.Error() != "found 2 environments in the repository, wanted one" {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestCopyServiceBetweenLayouts(t *testing.T) {
+	source, cleanupSource := makeLocalRepository(t, map[string]string{
+		"environments/dev/services/service-a/base/config/deployment.yaml":     "kind: Deployment\n",
+		"environments/dev/services/service-a/base/config/overlay/patch.yaml":  "kind: Deployment\n",
+		"environments/dev/services/service-a/base/not-promoted/resource.yaml": "kind: Service\n",
+	})
+	defer cleanupSource()
+	dest, cleanupDest := makeLocalRepository(t, map[string]string{
+		LayoutFile: "service: clusters/{env}/{service}\nconfig: manifests\n",
+		"clusters/staging/service-b/manifests/deployment.yaml": "kind: Deployment\n",
+	})
+	defer cleanupDest()
+
+	env, err := dest.GetUniqueEnvironmentFolder()
+	assertNoError(t, err)
+	copied, err := CopyService("service-a", source, dest, "dev", env)
+	assertNoError(t, err)
+
+	want := []string{
+		"clusters/staging/service-a/manifests/deployment.yaml",
+		"clusters/staging/service-a/manifests/overlay/patch.yaml",
+	}
+	if diff := cmp.Diff(want, copied); diff != "" {
+		t.Fatalf("copied files did not match: %s", diff)
+	}
+	assertRepoFileContents(t, dest, "clusters/staging/service-a/manifests/overlay/patch.yaml", "kind: Deployment\n")
+}
+
+func TestPromotionKeepsEnvironmentFilesWithPresets(t *testing.T) {
+	for _, preset := range []string{"default", "apps", "clusters"} {
+		t.Run(preset, func(t *testing.T) {
+			layout := Layouts[preset]
+			devPath, stagingPath := layout.ConfigPath("service-a", "dev"), layout.ConfigPath("service-a", "staging")
+			devService, stagingService := layout.ServicePath("service-a", "dev"), layout.ServicePath("service-a", "staging")
+			source, cleanupSource := makeLocalRepository(t, map[string]string{
+				LayoutFile:                                 "preset: " + preset + "\n",
+				path.Join(devPath, "deploy.yaml"):          "host: dev.example.com\n",
+				path.Join(devService, PromotionValuesFile): "values:\n  host: dev.example.com\n",
+				path.Join(devService, IgnoreFile):          "dev-only.yaml\n",
+			})
+			defer cleanupSource()
+			dest, cleanupDest := makeLocalRepository(t, map[string]string{
+				LayoutFile:                                     "preset: " + preset + "\n",
+				path.Join(stagingPath, "deploy.yaml"):          "host: staging.example.com\n",
+				path.Join(stagingService, PromotionValuesFile): "values:\n  host: staging.example.com\n",
+				path.Join(stagingService, IgnoreFile):          "staging-only.yaml\n",
+			})
+			defer cleanupDest()
+
+			copied, err := CopyService("service-a", source, dest, "dev", "staging")
+			assertNoError(t, err)
+			if diff := cmp.Diff([]string{path.Join(stagingPath, "deploy.yaml")}, copied); diff != "" {
+				t.Fatalf("copied files did not match: %s", diff)
+			}
+			removed, err := PruneService("service-a", dest, "staging", copied)
+			assertNoError(t, err)
+			if len(removed) != 0 {
+				t.Fatalf("got %v removed, want the environment's files kept", removed)
+			}
+			assertRepoFileContents(t, dest, path.Join(stagingService, PromotionValuesFile), "values:\n  host: staging.example.com\n")
+			assertRepoFileContents(t, dest, path.Join(stagingService, IgnoreFile), "staging-only.yaml\n")
+		})
+	}
+}
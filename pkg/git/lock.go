@@ -0,0 +1,70 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultLockTimeout is how long to wait for another promotion to release the
+// lock on a repository in the cache.
+const DefaultLockTimeout = 5 * time.Minute
+
+// lockRetryInterval is how often a held lock is retried.
+const lockRetryInterval = 100 * time.Millisecond
+
+// lockSuffix is appended to the path of a mirror or worktree in the cache for
+// the file that it's locked with.
+const lockSuffix = ".lock"
+
+// fileLock is an advisory lock on a file, it's used to stop promotions that
+// share a cache from changing the same repository at the same time.
+type fileLock struct {
+	f *os.File
+}
+
+// acquireLock waits for the lock on the file at path, creating it if it doesn't
+// exist, and returns an error if the lock isn't acquired before the timeout, or
+// the context is cancelled.
+func acquireLock(ctx context.Context, path string, timeout time.Duration) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating the directory for the lock %s: %w", path, err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := tryLock(path)
+		if err == nil {
+			return &fileLock{f: f}, nil
+		}
+		if err != errLocked {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %s waiting for the lock on %s, another promotion is using the repository", timeout, path)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for the lock on %s: %w", path, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// Release releases the lock.
+func (l *fileLock) Release() error {
+	return unlock(l.f)
+}
+
+// Remove releases the lock and removes the lock file, it's used for the locks
+// on paths that are removed from the cache.
+func (l *fileLock) Remove() error {
+	if err := l.Release(); err != nil {
+		return err
+	}
+	if err := os.Remove(l.f.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
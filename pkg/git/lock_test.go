@@ -0,0 +1,58 @@
+package git
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/rhd-gitops-example/services/test"
+)
+
+func TestAcquireLock(t *testing.T) {
+	tempDir, cleanup := makeTempDir(t)
+	defer cleanup()
+	lockPath := path.Join(tempDir, "cache", "repo.lock")
+
+	l, err := acquireLock(context.Background(), lockPath, time.Second)
+	assertNoError(t, err)
+
+	_, err = acquireLock(context.Background(), lockPath, 200*time.Millisecond)
+	test.AssertErrorMatch(t, "timed out after 200ms waiting for the lock on .*repo.lock", err)
+
+	assertNoError(t, l.Release())
+	l, err = acquireLock(context.Background(), lockPath, time.Second)
+	assertNoError(t, err)
+	assertNoError(t, l.Release())
+}
+
+func TestAcquireLockWaitsForRelease(t *testing.T) {
+	tempDir, cleanup := makeTempDir(t)
+	defer cleanup()
+	lockPath := path.Join(tempDir, "repo.lock")
+	l, err := acquireLock(context.Background(), lockPath, time.Second)
+	assertNoError(t, err)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		assertNoError(t, l.Release())
+	}()
+
+	waited, err := acquireLock(context.Background(), lockPath, 5*time.Second)
+	assertNoError(t, err)
+	assertNoError(t, waited.Release())
+}
+
+func TestAcquireLockStopsWhenCancelled(t *testing.T) {
+	tempDir, cleanup := makeTempDir(t)
+	defer cleanup()
+	lockPath := path.Join(tempDir, "repo.lock")
+	l, err := acquireLock(context.Background(), lockPath, time.Second)
+	assertNoError(t, err)
+	defer l.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = acquireLock(ctx, lockPath, time.Minute)
+	test.AssertErrorMatch(t, "stopped waiting for the lock on .*repo.lock: context deadline exceeded", err)
+}
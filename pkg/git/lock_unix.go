@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package git
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errLocked is returned by tryLock when the lock is held by another process.
+var errLocked = errors.New("the file is locked")
+
+func tryLock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func unlock(f *os.File) error {
+	// Closing the file releases the lock.
+	return f.Close()
+}
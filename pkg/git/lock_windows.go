@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package git
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// errLocked is returned by tryLock when the lock is held by another process.
+var errLocked = errors.New("the file is locked")
+
+// tryLock locks the file with LockFileEx, the lock is released by Windows if
+// the process exits without unlocking it, so a crashed promotion doesn't leave
+// a stale lock behind.
+func tryLock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &windows.Overlapped{})
+	if err != nil {
+		f.Close()
+		if err == windows.ERROR_LOCK_VIOLATION {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func unlock(f *os.File) error {
+	if err := windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -18,24 +18,40 @@ type Repository struct {
 	cloned        bool
 
 	files     []string
+	contents  map[string][]byte
 	localPath string
 
 	cloneErr    error
 	checkoutErr error
+	// CloneErrs are returned by the first calls to Clone, in order, e.g. to
+	// test that failures are retried.
+	CloneErrs []error
+
+	checkedOutRefs []string
+	CheckoutRefErr error
 
 	branchesCreated []string
 
 	copiedFiles []string
 	copyFileErr error
 
-	commits   []string
-	CommitErr error
+	removedFiles []string
+
+	commits       []string
+	signedCommits []string
+	CommitErr     error
 
 	pushedBranches []string
 	pushErr        error
+	// PushErrs are returned by the first calls to Push, in order.
+	PushErrs []error
+
+	rebasedBranches []string
+	RebaseErr       error
 
 	deleted   bool
 	DeleteErr error
+	released  bool
 
 	commitID string
 
@@ -76,9 +92,18 @@ func (m *Repository) CheckoutAndCreate(branch string) error {
 	return m.checkoutErr
 }
 
+// CheckoutRef fulfils the git.Repo interface.
+func (m *Repository) CheckoutRef(ref, branch string) error {
+	m.checkedOutRefs = append(m.checkedOutRefs, key(branch, ref))
+	return m.CheckoutRefErr
+}
+
 // Clone fulfils the git.Repo interface.
 func (m *Repository) Clone() error {
 	m.cloned = true
+	if err := nextErr(&m.CloneErrs); err != nil {
+		return err
+	}
 	return m.cloneErr
 }
 
@@ -92,7 +117,10 @@ func (m *Repository) Commit(msg string, author *git.Author) error {
 	if m.commits == nil {
 		m.commits = []string{}
 	}
-	m.commits = append(m.commits, key(m.currentBranch, msg, author.Token))
+	m.commits = append(m.commits, key(m.currentBranch, msg, authorKey(author)))
+	if author.Signing != nil {
+		m.signedCommits = append(m.signedCommits, key(m.currentBranch, msg, author.Signing.Format, author.Signing.Key))
+	}
 	return m.CommitErr
 }
 
@@ -117,15 +145,30 @@ func (m *Repository) GetUniqueEnvironmentFolder() (string, error) {
 	return foundEnv, nil
 }
 
+// Layout fulfils the git.Repo interface, the mock always uses the default
+// layout.
+func (m *Repository) Layout() *git.Layout {
+	return git.DefaultLayout
+}
+
 // Push fulfils the git.Repo interface.
 func (m *Repository) Push(branch string) error {
 	if m.pushedBranches == nil {
 		m.pushedBranches = []string{}
 	}
 	m.pushedBranches = append(m.pushedBranches, branch)
+	if err := nextErr(&m.PushErrs); err != nil {
+		return err
+	}
 	return m.pushErr
 }
 
+// Rebase fulfils the git.Repo interface.
+func (m *Repository) Rebase(branch string) error {
+	m.rebasedBranches = append(m.rebasedBranches, branch)
+	return m.RebaseErr
+}
+
 // CopyFile fulfils the git.Repo interface.
 func (m *Repository) CopyFile(src, dst string) error {
 	if m.copiedFiles == nil {
@@ -135,6 +178,41 @@ func (m *Repository) CopyFile(src, dst string) error {
 	return m.copyFileErr
 }
 
+// ReadFile fulfils the git.Repo interface.
+//
+// Files that were added with AddFiles or copied into the repository have empty
+// contents unless contents were added with AddFileContents.
+func (m *Repository) ReadFile(name string) ([]byte, error) {
+	name = path.Clean(name)
+	if c, ok := m.contents[name]; ok {
+		return c, nil
+	}
+	if hasString(name, m.files) {
+		return []byte{}, nil
+	}
+	for _, copied := range m.copiedFiles {
+		if strings.HasSuffix(copied, ":"+name) {
+			return []byte{}, nil
+		}
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+// RemoveFile fulfils the git.Repo interface.
+func (m *Repository) RemoveFile(name string) error {
+	name = path.Clean(name)
+	files := []string{}
+	for _, f := range m.files {
+		if f != name {
+			files = append(files, f)
+		}
+	}
+	m.files = files
+	delete(m.contents, name)
+	m.removedFiles = append(m.removedFiles, key(m.currentBranch, name))
+	return nil
+}
+
 // WriteFile fulfils the git.Repo interface.
 func (m *Repository) WriteFile(src io.Reader, dst string) error {
 	return nil
@@ -179,6 +257,16 @@ func (m *Repository) AddFiles(names ...string) {
 	}
 }
 
+// AddFileContents is part of the mock implementation, it records a filename
+// with the contents that are returned by ReadFile.
+func (m *Repository) AddFileContents(name string, contents []byte) {
+	m.AddFiles(name)
+	if m.contents == nil {
+		m.contents = map[string][]byte{}
+	}
+	m.contents[path.Join(m.localPath, name)] = contents
+}
+
 // DeleteCache deletes the repo from the local cache directory.
 func (m *Repository) DeleteCache() error {
 	if m.DeleteErr != nil {
@@ -188,6 +276,12 @@ func (m *Repository) DeleteCache() error {
 	return nil
 }
 
+// Release fulfils the git.Repo interface.
+func (m *Repository) Release() error {
+	m.released = true
+	return nil
+}
+
 // AssertBranchCreated asserts that the named branch was created from the from
 // branch, using the `CheckoutAndCreate` implementation.
 func (m *Repository) AssertBranchCreated(t *testing.T, from, name string) {
@@ -220,11 +314,42 @@ func (m *Repository) AssertFileNotCopiedInBranch(t *testing.T, branch, from, nam
 	}
 }
 
+// AssertFileRemovedInBranch asserts the filename was removed in a branch.
+func (m *Repository) AssertFileRemovedInBranch(t *testing.T, branch, name string) {
+	if !hasString(key(branch, name), m.removedFiles) {
+		t.Fatalf("file %s was not removed in branch %s", name, branch)
+	}
+}
+
+// AssertRefCheckedOut asserts that the ref was checked out from the branch,
+// using the `CheckoutRef` implementation.
+func (m *Repository) AssertRefCheckedOut(t *testing.T, branch, ref string) {
+	if !hasString(key(branch, ref), m.checkedOutRefs) {
+		t.Fatalf("ref %s was not checked out from branch %s", ref, branch)
+	}
+}
+
 // AssertCommit asserts that a commit was created for the named branch with the
-// message and auth token.
+// message, by the author.
+
 func (m *Repository) AssertCommit(t *testing.T, branch, msg string, a *git.Author) {
-	if !hasString(key(branch, msg, a.Token), m.commits) {
-		t.Fatalf("no matching commit %#v in branch %s using token %s.  Commits available: %+v", msg, branch, a.Token, m.commits)
+	if !hasString(key(branch, msg, authorKey(a)), m.commits) {
+		t.Fatalf("no matching commit %#v in branch %s by %s.  Commits available: %+v", msg, branch, authorKey(a), m.commits)
+	}
+}
+
+// AssertSignedCommit asserts that a commit was created for the named branch
+// with the message, and signed with the key.
+func (m *Repository) AssertSignedCommit(t *testing.T, branch, msg string, s *git.Signing) {
+	if !hasString(key(branch, msg, s.Format, s.Key), m.signedCommits) {
+		t.Fatalf("no matching commit %#v in branch %s signed with the %s key %s.  Signed commits available: %+v", msg, branch, s.Format, s.Key, m.signedCommits)
+	}
+}
+
+// AssertNoCommits asserts that no commits were created.
+func (m *Repository) AssertNoCommits(t *testing.T) {
+	if len(m.commits) != 0 {
+		t.Fatalf("unexpected commits created: %+v", m.commits)
 	}
 }
 
@@ -235,6 +360,20 @@ func (m *Repository) AssertPush(t *testing.T, branch string) {
 	}
 }
 
+// AssertRebased asserts that the last commit was rebased onto the branch.
+func (m *Repository) AssertRebased(t *testing.T, branch string) {
+	if !hasString(branch, m.rebasedBranches) {
+		t.Fatalf("branch %s was not rebased onto", branch)
+	}
+}
+
+// AssertNotRebased asserts that no commits were rebased.
+func (m *Repository) AssertNotRebased(t *testing.T) {
+	if len(m.rebasedBranches) != 0 {
+		t.Fatalf("unexpected rebases onto %+v", m.rebasedBranches)
+	}
+}
+
 // AssertDeletedFromCache asserts that delete was called to remove the local repo
 func (m *Repository) AssertDeletedFromCache(t *testing.T) {
 	if !m.deleted {
@@ -249,10 +388,43 @@ func (m *Repository) AssertNotDeletedFromCache(t *testing.T) {
 	}
 }
 
+// AssertReleased asserts that the repo was released so that it can be removed
+// from the cache later.
+func (m *Repository) AssertReleased(t *testing.T) {
+	if !m.released {
+		t.Fatal("repo was not released in the promotion cache directory")
+	}
+}
+
+// nextErr removes and returns the first of the errors, or nil if there are
+// none.
+func nextErr(errs *[]error) error {
+	if len(*errs) == 0 {
+		return nil
+	}
+	err := (*errs)[0]
+	*errs = (*errs)[1:]
+	return err
+}
+
 func key(v ...string) string {
 	return strings.Join(v, ":")
 }
 
+// authorKey identifies the author, committer and co-authors of a commit.
+func authorKey(a *git.Author) string {
+	author := git.Identity{Name: a.Name, Email: a.Email}
+	committer := author
+	if a.Committer != nil {
+		committer = *a.Committer
+	}
+	s := fmt.Sprintf("author %s committer %s", author, committer)
+	for _, c := range a.CoAuthors {
+		s += fmt.Sprintf(" co-author %s", c)
+	}
+	return s
+}
+
 func hasString(find string, list []string) bool {
 	for _, v := range list {
 		if find == v {
@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package git
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// runCommand runs the command in a process group of its own, which is killed
+// if the context is cancelled.
+//
+// exec.CommandContext only kills the command itself, the helpers that git
+// starts, e.g. git-remote-https, would keep its output open, and waiting for
+// the command wouldn't return until they exit.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package git
+
+import (
+	"context"
+	"os/exec"
+)
+
+// runCommand runs the command, which is killed by exec.CommandContext if the
+// context is cancelled.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	return cmd.Run()
+}
@@ -1,17 +1,21 @@
 package git
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/url"
 	"os"
 	"path"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/rhd-gitops-example/services/pkg/logging"
 	"github.com/rhd-gitops-example/services/test"
 )
 
@@ -44,7 +48,7 @@ func TestRepoName(t *testing.T) {
 func TestCloneCreatesDirectory(t *testing.T) {
 	tempDir, cleanup := makeTempDir(t)
 	defer cleanup()
-	r, err := NewRepository(testRepository, path.Join(tempDir, "path"), true, false)
+	r, err := NewRepository(testRepository, path.Join(tempDir, "path"), true, nil)
 	assertNoError(t, err)
 	err = r.Clone()
 	assertNoError(t, err)
@@ -227,20 +231,212 @@ func TestCommit(t *testing.T) {
 	}
 }
 
+func TestCommitWithCommitterAndCoAuthors(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	r := cloneUpstreamRepository(t, upstream)
+	assertNoError(t, r.WriteFile(strings.NewReader("this is some text"), "new-file.txt"))
+	assertNoError(t, r.StageFiles("new-file.txt"))
+	author := &Author{
+		Name:      "A Developer",
+		Email:     "developer@example.com",
+		Committer: &Identity{Name: "Promotion Bot", Email: "bot@example.com"},
+		CoAuthors: []Identity{{Name: "Another Developer", Email: "another@example.com"}},
+	}
+
+	assertNoError(t, r.Commit("this is a test commit", author))
+
+	out := string(assertExecGit(t, r, r.repoPath(), "log", "-n", "1", "--format=%an <%ae>%n%cn <%ce>%n%B"))
+	want := "A Developer <developer@example.com>\nPromotion Bot <bot@example.com>\nthis is a test commit\n\nCo-authored-by: Another Developer <another@example.com>\n\n"
+	if diff := cmp.Diff(want, out); diff != "" {
+		t.Fatalf("commit didn't match: %s", diff)
+	}
+	// The identities aren't written to the repository's configuration.
+	if out, err := r.execGit(r.repoPath(), nil, "config", "--local", "--get", "user.name"); err == nil {
+		t.Fatalf("user.name was configured: %s", out)
+	}
+}
+
+func TestCheckoutFetchesBranch(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	assertExecGit(t, upstream, upstream.repoPath(), "checkout", "-b", "team-a")
+	assertNoError(t, upstream.WriteFile(strings.NewReader("team-a"), "team-a.txt"))
+	assertExecGit(t, upstream, upstream.repoPath(), "add", "team-a.txt")
+	assertExecGit(t, upstream, upstream.repoPath(), "commit", "-m", "team-a commit")
+	assertExecGit(t, upstream, upstream.repoPath(), "checkout", "master")
+	r := cloneUpstreamRepository(t, upstream)
+
+	assertNoError(t, r.Checkout("team-a"))
+
+	assertHead(t, r, upstreamHead(t, upstream, "team-a"))
+	if _, err := r.ReadFile("team-a.txt"); err != nil {
+		t.Fatalf("branch team-a was not checked out: %s", err)
+	}
+}
+
+func TestCheckoutResetsStaleCache(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	r := cloneUpstreamRepository(t, upstream)
+	assertNoError(t, r.Checkout("master"))
+	assertNoError(t, r.WriteFile(strings.NewReader("stale"), "stale.txt"))
+	assertExecGit(t, r, r.repoPath(), "add", "stale.txt")
+	assertNoError(t, r.Commit("stale commit", &Author{Name: "Test User", Email: "testing@example.com"}))
+	assertNoError(t, r.WriteFile(strings.NewReader("untracked"), "untracked.txt"))
+	assertNoError(t, r.WriteFile(strings.NewReader("changed"), "README.md"))
+	assertExecGit(t, upstream, upstream.repoPath(), "commit", "--allow-empty", "-m", "upstream commit")
+
+	assertNoError(t, r.Clone())
+	assertNoError(t, r.Checkout("master"))
+
+	assertHead(t, r, upstreamHead(t, upstream, "master"))
+	out := assertExecGit(t, r, r.repoPath(), "status", "--porcelain")
+	if len(out) != 0 {
+		t.Fatalf("working tree was not reset: %s", out)
+	}
+}
+
+func TestCheckoutAndCreateResetsExistingBranch(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	r := cloneUpstreamRepository(t, upstream)
+	assertNoError(t, r.Checkout("master"))
+	assertNoError(t, r.CheckoutAndCreate("my-new-branch"))
+	assertNoError(t, r.WriteFile(strings.NewReader("earlier"), "earlier.txt"))
+	assertNoError(t, r.StageFiles("earlier.txt"))
+	assertNoError(t, r.Commit("earlier promotion", &Author{Name: "Test User", Email: "testing@example.com"}))
+	assertNoError(t, r.Checkout("master"))
+
+	assertNoError(t, r.CheckoutAndCreate("my-new-branch"))
+
+	assertHead(t, r, upstreamHead(t, upstream, "master"))
+}
+
+func TestCheckoutRef(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	first := strings.TrimSpace(string(assertExecGit(t, upstream, upstream.repoPath(), "rev-parse", "HEAD")))
+	assertExecGit(t, upstream, upstream.repoPath(), "tag", "v1.0.0")
+	assertExecGit(t, upstream, upstream.repoPath(), "commit", "--allow-empty", "-m", "second commit")
+	assertExecGit(t, upstream, upstream.repoPath(), "checkout", "-b", "unmerged")
+	assertExecGit(t, upstream, upstream.repoPath(), "commit", "--allow-empty", "-m", "unmerged commit")
+	unmerged := strings.TrimSpace(string(assertExecGit(t, upstream, upstream.repoPath(), "rev-parse", "HEAD")))
+	assertExecGit(t, upstream, upstream.repoPath(), "checkout", "master")
+
+	r := cloneUpstreamRepository(t, upstream)
+	assertNoError(t, r.Checkout("master"))
+
+	assertNoError(t, r.CheckoutRef("v1.0.0", "master"))
+	assertHead(t, r, first)
+
+	err := r.CheckoutRef(unmerged, "master")
+	test.AssertErrorMatch(t, "ref [0-9a-f]+ is not reachable from branch master", err)
+
+	err = r.CheckoutRef("v9.9.9", "master")
+	test.AssertErrorMatch(t, "ref v9.9.9 was not found in the repository", err)
+}
+
+func TestGitCommandSuppliesToken(t *testing.T) {
+	tempDir, cleanup := makeTempDir(t)
+	defer cleanup()
+	r := &Repository{tlsVerify: true, token: "my-secret-token"}
+
+	cmd := r.gitCommand(context.Background(), tempDir, nil, "credential", "fill")
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=github.com\n\n")
+	out, err := cmd.Output()
+	assertNoError(t, err)
+
+	want := "protocol=https\nhost=github.com\nusername=promotion\npassword=my-secret-token\n"
+	if diff := cmp.Diff(want, string(out)); diff != "" {
+		t.Fatalf("credentials don't match: %s", diff)
+	}
+	if strings.Contains(strings.Join(cmd.Args, " "), "my-secret-token") {
+		t.Fatalf("token found in the command line: %s", cmd.Args)
+	}
+}
+
+func TestExecGitRequestsTokenFromSource(t *testing.T) {
+	var requests int
+	r := &Repository{tlsVerify: true}
+	r.SetTokenSource(func(ctx context.Context) (string, error) {
+		requests++
+		return fmt.Sprintf("token-%d", requests), nil
+	})
+
+	for _, want := range []string{"token-1", "token-2"} {
+		_, err := r.execGit("", nil, "version")
+		assertNoError(t, err)
+		if r.token != want {
+			t.Fatalf("got token %q, want %q", r.token, want)
+		}
+	}
+}
+
+func TestExecGitWithFailingTokenSource(t *testing.T) {
+	r := &Repository{tlsVerify: true}
+	r.SetTokenSource(func(ctx context.Context) (string, error) {
+		return "", errors.New("failed to create a token")
+	})
+
+	_, err := r.execGit("", nil, "version")
+	test.AssertErrorMatch(t, "failed to create a token", err)
+}
+
+func TestGitCommandWithoutToken(t *testing.T) {
+	r := &Repository{tlsVerify: true}
+
+	cmd := r.gitCommand(context.Background(), "", nil, "status")
+
+	if diff := cmp.Diff([]string{"git", "status"}, cmd.Args); diff != "" {
+		t.Fatalf("command doesn't match: %s", diff)
+	}
+}
+
 func TestExecGit(t *testing.T) {
 	r, cleanup := cloneTestRepository(t)
-	r.debug = true
-	captured := ""
-	r.logger = func(f string, v ...interface{}) {
-		captured = fmt.Sprintf(f, v...)
-	}
+	var captured bytes.Buffer
+	r.logger = logging.New(&captured, logging.FormatText, logging.LevelDebug, nil)
 	defer cleanup()
 	_, err := r.execGit(r.repoPath(), nil, "unknown")
 	test.AssertErrorMatch(t, "exit status 1", err)
 
-	want := "DEBUG: git: 'unknown' is not a git command. See 'git --help'."
-	if strings.TrimSpace(captured) != want {
-		t.Fatalf("execGit debug log failed: got %s, want %s", captured, want)
+	want := `DEBUG git command failed command=unknown output="git: 'unknown' is not a git command. See 'git --help'.`
+	if !strings.Contains(captured.String(), want) {
+		t.Fatalf("execGit debug log failed: got %s, want %s", captured.String(), want)
+	}
+}
+
+func TestExecGitLogsRedactedOutput(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	var captured bytes.Buffer
+	upstream.logger = logging.New(&captured, logging.FormatText, logging.LevelDebug, nil)
+	upstream.token = "my-secret-token"
+
+	_, err := upstream.execGit(upstream.repoPath(), nil, "checkout", "my-secret-token")
+	test.AssertErrorMatch(t, "git checkout failed", err)
+
+	if !strings.Contains(captured.String(), "git command failed command=checkout") || strings.Contains(captured.String(), "my-secret-token") {
+		t.Fatalf("execGit debug log failed: got %s", captured.String())
+	}
+}
+
+func TestExecGitKillsCommandWhenCancelled(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := upstream.execGitContext(ctx, upstream.repoPath(), nil, "-c", "alias.hang=!sleep 30", "hang")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the command to time out", err)
+	}
+	test.AssertErrorMatch(t, "git hang failed: context deadline exceeded", err)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("the command was not killed, it took %s", elapsed)
 	}
 }
 
@@ -263,33 +459,66 @@ func TestPush(t *testing.T) {
 	assertNoError(t, err)
 }
 
-func TestDebugEnabled(t *testing.T) {
+func TestNewRepositoryWithLogger(t *testing.T) {
 	tempDir, cleanup := makeTempDir(t)
 	defer cleanup()
-	r, err := NewRepository(testRepository, path.Join(tempDir, "path"), false, true)
+	logger := logging.Discard()
+	r, err := NewRepository(testRepository, path.Join(tempDir, "path"), false, logger)
 	assertNoError(t, err)
-	if !r.debug {
-		t.Fatalf("Debug not set to true")
+	if r.log() != logger {
+		t.Fatalf("logger not set")
 	}
 }
 
 func cloneTestRepository(t *testing.T) (*Repository, func()) {
 	tempDir, cleanup := makeTempDir(t)
-	r, err := NewRepository(authenticatedURL(t), tempDir, false, false)
+	r, err := NewRepository(testRepository, tempDir, false, nil)
 	assertNoError(t, err)
+	r.SetToken(authToken())
 	err = r.Clone()
 	assertNoError(t, err)
 	return r, cleanup
 }
 
-func authenticatedURL(t *testing.T) string {
+// makeUpstreamRepository creates a repository with a single commit on the
+// master branch, that can be cloned without network access.
+func makeUpstreamRepository(t *testing.T) (*Repository, func()) {
 	t.Helper()
-	parsed, err := url.Parse(testRepository)
-	if err != nil {
-		t.Fatalf("failed to parse git repo url %v: %v", testRepository, err)
+	tempDir, cleanup := makeTempDir(t)
+	r, err := NewRepository(path.Join(tempDir, "upstream", "repo"), path.Join(tempDir, "upstream"), true, nil)
+	assertNoError(t, err)
+	assertNoError(t, os.MkdirAll(r.repoPath(), 0755))
+	assertExecGit(t, r, r.repoPath(), "init")
+	assertExecGit(t, r, r.repoPath(), "checkout", "-b", "master")
+	assertExecGit(t, r, r.repoPath(), "config", "user.name", "Test User")
+	assertExecGit(t, r, r.repoPath(), "config", "user.email", "testing@example.com")
+	assertNoError(t, r.WriteFile(strings.NewReader("this is some text"), "README.md"))
+	assertExecGit(t, r, r.repoPath(), "add", "README.md")
+	assertExecGit(t, r, r.repoPath(), "commit", "-m", "first commit")
+	return r, cleanup
+}
+
+// cloneUpstreamRepository clones a repository created by
+// makeUpstreamRepository, the clone is removed with the upstream repository.
+func cloneUpstreamRepository(t *testing.T, upstream *Repository) *Repository {
+	t.Helper()
+	r, err := NewRepository(upstream.repoPath(), path.Join(upstream.LocalPath, "..", "cache"), true, nil)
+	assertNoError(t, err)
+	assertNoError(t, r.Clone())
+	return r
+}
+
+func upstreamHead(t *testing.T, upstream *Repository, branch string) string {
+	t.Helper()
+	return strings.TrimSpace(string(assertExecGit(t, upstream, upstream.repoPath(), "rev-parse", branch)))
+}
+
+func assertHead(t *testing.T, r *Repository, want string) {
+	t.Helper()
+	head := strings.TrimSpace(string(assertExecGit(t, r, r.repoPath(), "rev-parse", "HEAD")))
+	if head != want {
+		t.Fatalf("got HEAD %s, want %s", head, want)
 	}
-	parsed.User = url.UserPassword("promotion", authToken())
-	return parsed.String()
 }
 
 func makeTempDir(t *testing.T) (string, func()) {
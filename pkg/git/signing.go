@@ -0,0 +1,89 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The formats that commits can be signed in.
+const (
+	GPGFormat = "gpg"
+	SSHFormat = "ssh"
+)
+
+// Signing configures how commits are signed.
+type Signing struct {
+	// Key is the GPG key ID, or the path to the SSH key, to sign with.
+	Key string
+	// Format is GPGFormat or SSHFormat.
+	Format string
+}
+
+// NewSigning creates and returns a Signing for the key, if there's no key,
+// commits are not signed, and nil is returned.
+func NewSigning(key, format string) (*Signing, error) {
+	format = strings.ToLower(format)
+	if format != GPGFormat && format != SSHFormat {
+		return nil, fmt.Errorf("invalid signing format %q, must be %s or %s", format, GPGFormat, SSHFormat)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	return &Signing{Key: key, Format: format}, nil
+}
+
+// signingFailures are the output from git, gpg and ssh-keygen when a commit
+// can't be signed.
+var signingFailures = []string{
+	"gpg failed to sign", "couldn't load public key", "ssh-keygen", "load key", "signing failed",
+}
+
+// isSigningFailure returns true if the output of git commit shows that the
+// commit failed because it couldn't be signed.
+func isSigningFailure(output string) bool {
+	output = strings.ToLower(output)
+	for _, p := range signingFailures {
+		if strings.Contains(output, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// configArgs returns the git configuration to sign commits with the key.
+func (s *Signing) configArgs() []string {
+	gpgFormat := "openpgp"
+	if s.Format == SSHFormat {
+		gpgFormat = "ssh"
+	}
+	return []string{"-c", "gpg.format=" + gpgFormat, "-c", "user.signingkey=" + s.Key}
+}
+
+// Keyring is the trusted keys that commit signatures are verified with.
+type Keyring struct {
+	// GPGHome is a GnuPG home directory with the trusted public keys, the
+	// user's keyring is used if it's empty.
+	GPGHome string
+	// AllowedSigners is an SSH allowed signers file with the trusted public
+	// keys, see ssh-keygen(1).
+	AllowedSigners string
+}
+
+// VerifyCommit verifies that the commit is signed by a key in the keyring.
+func (r *Repository) VerifyCommit(rev string, keyring Keyring) error {
+	if strings.HasPrefix(rev, "-") {
+		return fmt.Errorf("invalid commit %s", rev)
+	}
+	args := []string{"verify-commit", rev}
+	if keyring.AllowedSigners != "" {
+		args = append([]string{"-c", "gpg.ssh.allowedSignersFile=" + keyring.AllowedSigners}, args...)
+	}
+	var env []string
+	if keyring.GPGHome != "" {
+		env = []string{"GNUPGHOME=" + keyring.GPGHome}
+	}
+	if _, err := r.execGit(r.repoPath(), env, args...); err != nil {
+		return fmt.Errorf("failed to verify the signature of commit %s: %w", rev, err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rhd-gitops-example/services/test"
+)
+
+func TestNewSigning(t *testing.T) {
+	s, err := NewSigning("~/.ssh/id_ed25519.pub", "SSH")
+	assertNoError(t, err)
+	if s.Format != SSHFormat || s.Key != "~/.ssh/id_ed25519.pub" {
+		t.Fatalf("got %#v, want an ssh key", s)
+	}
+
+	s, err = NewSigning("", GPGFormat)
+	assertNoError(t, err)
+	if s != nil {
+		t.Fatalf("got %#v, want no signing without a key", s)
+	}
+
+	_, err = NewSigning("ABCDEF", "x509")
+	test.AssertErrorMatch(t, `invalid signing format "x509", must be gpg or ssh`, err)
+}
+
+func TestCommitSignedWithSSHKey(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	keyDir, cleanupKeys := makeTempDir(t)
+	defer cleanupKeys()
+	key := mustGenerateSSHKey(t, keyDir, "signing")
+	otherKey := mustGenerateSSHKey(t, keyDir, "other")
+	author := &Author{Name: "Testing User", Email: "testing@example.com", Signing: &Signing{Key: key, Format: SSHFormat}}
+
+	assertNoError(t, upstream.WriteFile(strings.NewReader("signed"), "signed.txt"))
+	assertNoError(t, upstream.StageFiles("signed.txt"))
+	assertNoError(t, upstream.Commit("signed commit", author))
+
+	assertNoError(t, upstream.VerifyCommit("HEAD", Keyring{AllowedSigners: mustWriteAllowedSigners(t, keyDir, key)}))
+	err := upstream.VerifyCommit("HEAD", Keyring{AllowedSigners: mustWriteAllowedSigners(t, keyDir, otherKey)})
+	test.AssertErrorMatch(t, "failed to verify the signature of commit HEAD", err)
+	err = upstream.VerifyCommit("HEAD~1", Keyring{AllowedSigners: mustWriteAllowedSigners(t, keyDir, key)})
+	test.AssertErrorMatch(t, "failed to verify the signature of commit HEAD~1", err)
+}
+
+func TestVerifyCommitRedactsOutput(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	upstream.token = "my-secret-token"
+
+	err := upstream.VerifyCommit("my-secret-token", Keyring{})
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("got %#v, want a CommandError", err)
+	}
+	if cmdErr.Command != "verify-commit" || cmdErr.Output == "" || strings.Contains(cmdErr.Output, "my-secret-token") {
+		t.Fatalf("got command %s with output %q, want the redacted output of verify-commit", cmdErr.Command, cmdErr.Output)
+	}
+}
+
+func TestCommitSignedWithGPGKey(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	gpgHome, err := ioutil.TempDir("", "gpg")
+	assertNoError(t, err)
+	defer os.RemoveAll(gpgHome)
+	if old, ok := os.LookupEnv("GNUPGHOME"); ok {
+		defer os.Setenv("GNUPGHOME", old)
+	} else {
+		defer os.Unsetenv("GNUPGHOME")
+	}
+	assertNoError(t, os.Setenv("GNUPGHOME", gpgHome))
+	defer exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+	mustRun(t, "gpg", "--batch", "--passphrase", "", "--quick-gen-key", "Testing User <testing@example.com>", "ed25519", "sign", "never")
+	author := &Author{Name: "Testing User", Email: "testing@example.com", Signing: &Signing{Key: "testing@example.com", Format: GPGFormat}}
+
+	assertNoError(t, upstream.WriteFile(strings.NewReader("signed"), "signed.txt"))
+	assertNoError(t, upstream.StageFiles("signed.txt"))
+	assertNoError(t, upstream.Commit("signed commit", author))
+
+	assertNoError(t, upstream.VerifyCommit("HEAD", Keyring{GPGHome: gpgHome}))
+	err = upstream.VerifyCommit("HEAD~1", Keyring{GPGHome: gpgHome})
+	test.AssertErrorMatch(t, "failed to verify the signature of commit HEAD~1", err)
+}
+
+func TestCommitWithMissingSigningKey(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	author := &Author{Name: "Testing User", Email: "testing@example.com", Signing: &Signing{Key: "/does/not/exist", Format: SSHFormat}}
+
+	assertNoError(t, upstream.WriteFile(strings.NewReader("signed"), "signed.txt"))
+	assertNoError(t, upstream.StageFiles("signed.txt"))
+	err := upstream.Commit("signed commit", author)
+	test.AssertErrorMatch(t, "failed to sign the commit with the ssh key /does/not/exist", err)
+}
+
+func TestCommitWithSigningAndNoChanges(t *testing.T) {
+	upstream, cleanup := makeUpstreamRepository(t)
+	defer cleanup()
+	author := &Author{Name: "Testing User", Email: "testing@example.com", Signing: &Signing{Key: "/does/not/exist", Format: SSHFormat}}
+
+	err := upstream.Commit("signed commit", author)
+	if !errors.Is(err, ErrNoChanges) {
+		t.Fatalf("got %v, want ErrNoChanges", err)
+	}
+	if strings.Contains(err.Error(), "failed to sign") {
+		t.Fatalf("got %q, want it not to be reported as a signing failure", err)
+	}
+}
+
+func TestIsSigningFailure(t *testing.T) {
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{"error: gpg failed to sign the data\nfatal: failed to write commit object", true},
+		{"error: Couldn't load public key /does/not/exist: No such file or directory?\n\nfatal: failed to write commit object", true},
+		{"On branch master\nnothing to commit, working tree clean", false},
+		{"fatal: Unable to create '/tmp/repo/.git/index.lock': File exists.", false},
+	}
+	for _, tt := range tests {
+		if got := isSigningFailure(tt.output); got != tt.want {
+			t.Errorf("isSigningFailure(%q) got %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+// mustGenerateSSHKey generates an SSH key without a passphrase, and returns the
+// path to the private key.
+func mustGenerateSSHKey(t *testing.T, dir, name string) string {
+	t.Helper()
+	key := filepath.Join(dir, name)
+	mustRun(t, "ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", name, "-f", key)
+	return key
+}
+
+// mustWriteAllowedSigners writes an SSH allowed signers file that trusts the
+// key for the test email, and returns its path.
+func mustWriteAllowedSigners(t *testing.T, dir, key string) string {
+	t.Helper()
+	pub, err := ioutil.ReadFile(key + ".pub")
+	assertNoError(t, err)
+	filename := filepath.Join(dir, filepath.Base(key)+".allowed_signers")
+	assertNoError(t, ioutil.WriteFile(filename, []byte("testing@example.com "+string(pub)), 0644))
+	return filename
+}
+
+func mustRun(t *testing.T, name string, args ...string) {
+	t.Helper()
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		t.Fatalf("%s %s failed: %s (%s)", name, strings.Join(args, " "), err, out)
+	}
+}
@@ -0,0 +1,217 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PromotionValuesFile is the name of the file in a service's folder that
+// provides the values that are specific to an environment.
+const PromotionValuesFile = "promotion-values.yaml"
+
+// promotionValues is the format of the PromotionValuesFile e.g.
+//
+//	substitutions:
+//	- file: ingress.yaml
+//	  path: spec.rules[0].host
+//	  value: staging.example.com
+//
+// The file is a glob relative to the service's configuration folder, and the
+// kind limits the substitution to resources of that kind, if either are empty
+// the substitution applies to every promoted file.
+type promotionValues struct {
+	Substitutions []struct {
+		File  string    `yaml:"file"`
+		Kind  string    `yaml:"kind"`
+		Path  string    `yaml:"path"`
+		Value yaml.Node `yaml:"value"`
+	} `yaml:"substitutions"`
+}
+
+// Substitution records a value that was changed in a promoted file.
+type Substitution struct {
+	File string
+	Path string
+	From string
+	To   string
+}
+
+// SubstituteValues applies the values in the service's PromotionValuesFile in
+// the repository to the named files, so that environment specific values (e.g.
+// hostnames) are kept when configuration is promoted from another environment.
+//
+// Paths are only changed if they already exist in a resource, paths can be
+// written as spec.rules[0].host, or as a JSONPath e.g. $.spec.rules[0].host,
+// with keys that contain dots quoted e.g. metadata.annotations["example.com/name"].
+//
+// Returns the substitutions that were made, and possibly an error.
+func SubstituteValues(serviceName string, r Repo, environmentName string, filenames []string) ([]Substitution, error) {
+	layout := r.Layout()
+	servicePath := layout.ServicePath(serviceName, environmentName)
+	valuesPath := path.Join(servicePath, PromotionValuesFile)
+	data, err := r.ReadFile(valuesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", valuesPath, err)
+	}
+	var values promotionValues
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", valuesPath, err)
+	}
+	for _, s := range values.Substitutions {
+		if _, err := parseValuePath(s.Path); err != nil {
+			return nil, fmt.Errorf("invalid path %q in %s: %w", s.Path, valuesPath, err)
+		}
+	}
+
+	configPath := layout.ConfigPath(serviceName, environmentName)
+	substitutions := []Substitution{}
+	for _, filename := range filenames {
+		if !isYAML(filename) {
+			continue
+		}
+		data, err := r.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		docs, err := decodeDocuments(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+		relPath := strings.TrimPrefix(filename, configPath+"/")
+		changed := false
+		for _, s := range values.Substitutions {
+			if s.File != "" {
+				if ok, _ := filepath.Match(s.File, relPath); !ok {
+					continue
+				}
+			}
+			segments, _ := parseValuePath(s.Path)
+			for _, doc := range docs {
+				if len(doc.Content) == 0 {
+					continue
+				}
+				root := doc.Content[0]
+				if s.Kind != "" && scalarValue(root, "kind") != s.Kind {
+					continue
+				}
+				target := lookupValuePath(root, segments)
+				if target == nil || nodesEqual(target, &s.Value) {
+					continue
+				}
+				substitutions = append(substitutions, Substitution{File: filename, Path: s.Path, From: nodeString(target), To: nodeString(&s.Value)})
+				replaceNode(target, &s.Value)
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		out, err := encodeDocuments(docs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", filename, err)
+		}
+		if err := r.WriteFile(bytes.NewReader(out), filename); err != nil {
+			return nil, err
+		}
+	}
+	return substitutions, nil
+}
+
+// parseValuePath splits a path like $.spec.rules[0]["host"] into the keys and
+// indices to follow, indices are returned as ints.
+func parseValuePath(p string) ([]interface{}, error) {
+	p = strings.TrimPrefix(strings.TrimPrefix(p, "$"), ".")
+	segments := []interface{}{}
+	for len(p) > 0 {
+		switch {
+		case strings.HasPrefix(p, `["`) || strings.HasPrefix(p, `['`):
+			end := strings.Index(p[2:], string(p[1])+"]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated key in %q", p)
+			}
+			segments = append(segments, p[2:2+end])
+			p = p[end+4:]
+		case p[0] == '[':
+			end := strings.Index(p, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated index in %q", p)
+			}
+			i, err := strconv.Atoi(p[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid index in %q", p)
+			}
+			segments = append(segments, i)
+			p = p[end+1:]
+		case p[0] == '.':
+			p = p[1:]
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			segments = append(segments, p[:end])
+			p = p[end:]
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return segments, nil
+}
+
+// lookupValuePath returns the node at the path, or nil if it doesn't exist.
+func lookupValuePath(n *yaml.Node, segments []interface{}) *yaml.Node {
+	for _, s := range segments {
+		switch v := s.(type) {
+		case string:
+			n = mappingValue(n, v)
+		case int:
+			if n.Kind != yaml.SequenceNode || v < 0 || v >= len(n.Content) {
+				return nil
+			}
+			n = n.Content[v]
+		}
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// replaceNode replaces the value of the target node, keeping its comments.
+func replaceNode(target, value *yaml.Node) {
+	target.Kind = value.Kind
+	target.Tag = value.Tag
+	target.Value = value.Value
+	target.Style = value.Style
+	target.Content = value.Content
+}
+
+func nodesEqual(a, b *yaml.Node) bool {
+	return a.Kind == b.Kind && nodeString(a) == nodeString(b)
+}
+
+// nodeString returns a compact representation of a node for logging.
+func nodeString(n *yaml.Node) string {
+	if n.Kind == yaml.ScalarNode {
+		return n.Value
+	}
+	out, err := yaml.Marshal(&yaml.Node{Kind: n.Kind, Tag: n.Tag, Content: n.Content, Style: yaml.FlowStyle})
+	if err != nil {
+		return fmt.Sprintf("%v", n.Content)
+	}
+	return strings.TrimSpace(string(out))
+}
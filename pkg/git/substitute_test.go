@@ -0,0 +1,103 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSubstituteValues(t *testing.T) {
+	r, cleanup := makeLocalRepository(t, map[string]string{
+		"environments/staging/services/service-a/promotion-values.yaml": `substitutions:
+- file: ingress.yaml
+  path: spec.rules[0].host
+  value: staging.example.com
+- kind: Deployment
+  path: $.spec.replicas
+  value: 3
+- path: metadata.annotations["example.com/environment"]
+  value: staging
+- path: spec.missing
+  value: ignored
+`,
+		"environments/staging/services/service-a/base/config/ingress.yaml": `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  annotations:
+    example.com/environment: dev
+spec:
+  rules:
+    - host: dev.example.com # the public hostname
+`,
+		"environments/staging/services/service-a/base/config/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 1\n",
+		"environments/staging/services/service-a/base/config/service.yaml":    "apiVersion: v1\nkind: Service\nspec:\n  replicas: 1\n",
+	})
+	defer cleanup()
+
+	subs, err := SubstituteValues("service-a", r, "staging", []string{
+		"environments/staging/services/service-a/base/config/ingress.yaml",
+		"environments/staging/services/service-a/base/config/deployment.yaml",
+		"environments/staging/services/service-a/base/config/service.yaml",
+	})
+	assertNoError(t, err)
+
+	want := []Substitution{
+		{File: "environments/staging/services/service-a/base/config/ingress.yaml", Path: "spec.rules[0].host", From: "dev.example.com", To: "staging.example.com"},
+		{File: "environments/staging/services/service-a/base/config/ingress.yaml", Path: `metadata.annotations["example.com/environment"]`, From: "dev", To: "staging"},
+		{File: "environments/staging/services/service-a/base/config/deployment.yaml", Path: "$.spec.replicas", From: "1", To: "3"},
+	}
+	if diff := cmp.Diff(want, subs); diff != "" {
+		t.Fatalf("substitutions did not match: %s", diff)
+	}
+	assertRepoFileContents(t, r, "environments/staging/services/service-a/base/config/ingress.yaml", `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  annotations:
+    example.com/environment: staging
+spec:
+  rules:
+    - host: staging.example.com # the public hostname
+`)
+	assertRepoFileContents(t, r, "environments/staging/services/service-a/base/config/deployment.yaml", "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 3\n")
+	assertRepoFileContents(t, r, "environments/staging/services/service-a/base/config/service.yaml", "apiVersion: v1\nkind: Service\nspec:\n  replicas: 1\n")
+}
+
+func TestSubstituteValuesWithNoValuesFile(t *testing.T) {
+	r, cleanup := makeLocalRepository(t, map[string]string{
+		"environments/staging/services/service-a/base/config/deployment.yaml": "kind: Deployment\n",
+	})
+	defer cleanup()
+
+	subs, err := SubstituteValues("service-a", r, "staging", []string{"environments/staging/services/service-a/base/config/deployment.yaml"})
+	assertNoError(t, err)
+	if len(subs) != 0 {
+		t.Fatalf("unexpected substitutions: %#v", subs)
+	}
+}
+
+func TestParseValuePath(t *testing.T) {
+	pathTests := []struct {
+		path    string
+		want    []interface{}
+		wantErr string
+	}{
+		{"spec.replicas", []interface{}{"spec", "replicas"}, ""},
+		{"$.spec.rules[0].host", []interface{}{"spec", "rules", 0, "host"}, ""},
+		{".metadata.annotations['example.com/name']", []interface{}{"metadata", "annotations", "example.com/name"}, ""},
+		{"spec.rules[first]", nil, `invalid index in "[first]"`},
+		{"$", nil, "empty path"},
+	}
+
+	for _, tt := range pathTests {
+		segments, err := parseValuePath(tt.path)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("parseValuePath(%s) got error %v, want %s", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if diff := cmp.Diff(tt.want, segments); diff != "" {
+			t.Errorf("parseValuePath(%s) did not match: %s", tt.path, diff)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/rhd-gitops-example/services/pkg/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// Tokens finds the access tokens for repositories, so that the source and
+// destination of a promotion can be on different hosts with different
+// credentials.
+//
+// A GitHub App installed for the repository's host is used if there is one,
+// then the token for the host, otherwise the default token, and if that's
+// empty, git's credential helpers are asked for a token if they're enabled.
+type Tokens struct {
+	// Default is the token for hosts without a token of their own.
+	Default string
+	// Hosts are the tokens for hosts, the keys are host names, optionally with
+	// a port.
+	Hosts map[string]string
+	// Apps are the GitHub Apps that authenticate with hosts, the keys are host
+	// names, optionally with a port.
+	Apps map[string]*GitHubApp
+	// CredentialHelpers enables asking git's credential helpers for tokens.
+	CredentialHelpers bool
+	// Secrets, if it's not nil, has the tokens added as they're found, so
+	// that they're redacted from the logs.
+	Secrets *logging.Secrets
+
+	mu     sync.Mutex
+	filled map[string]string
+}
+
+// Token returns the access token for the repository, this is empty if there's
+// no token for it, or the repository isn't accessed over HTTP(S).
+//
+// Minting a GitHub App token, or asking git's credential helpers, is abandoned
+// if the context is cancelled.
+func (t *Tokens) Token(ctx context.Context, repoURL string) (string, error) {
+	token, err := t.token(ctx, repoURL)
+	if err != nil {
+		return "", err
+	}
+	t.Secrets.Add(token)
+	return token, nil
+}
+
+func (t *Tokens) token(ctx context.Context, repoURL string) (string, error) {
+	parsed, err := url.Parse(repoURL)
+	if err != nil {
+		// Don't surface the URL as it could contain a token
+		return "", errors.New("failed to parse the URL when finding the access token")
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return "", nil
+	}
+	for _, host := range []string{strings.ToLower(parsed.Host), strings.ToLower(parsed.Hostname())} {
+		if app, ok := t.Apps[host]; ok {
+			return app.Token(ctx)
+		}
+	}
+	if token, ok := t.Hosts[strings.ToLower(parsed.Host)]; ok {
+		return token, nil
+	}
+	if token, ok := t.Hosts[strings.ToLower(parsed.Hostname())]; ok {
+		return token, nil
+	}
+	if t.Default != "" || !t.CredentialHelpers {
+		return t.Default, nil
+	}
+	return t.fill(ctx, parsed.Scheme, parsed.Host)
+}
+
+// fill asks git's credential helpers for the password for the host, the
+// answers are remembered so that the helpers are only asked once.
+func (t *Tokens) fill(ctx context.Context, scheme, host string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := scheme + "://" + host
+	if token, ok := t.filled[key]; ok {
+		return token, nil
+	}
+	token, err := credentialFill(ctx, scheme, host)
+	if err != nil {
+		return "", err
+	}
+	if t.filled == nil {
+		t.filled = map[string]string{}
+	}
+	t.filled[key] = token
+	return token, nil
+}
+
+// credentialFill runs git credential fill, if no helper has credentials for
+// the host the token is empty, git is killed if the context is cancelled.
+func credentialFill(ctx context.Context, scheme, host string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\n\n", scheme, host))
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// The helpers started by git are killed with it if the context is
+	// cancelled.
+	if err := runCommand(ctx, cmd); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		// git fails if there are no credentials, and it can't prompt for them.
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to run git credential fill: %w", err)
+	}
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		if password := strings.TrimPrefix(scanner.Text(), "password="); password != scanner.Text() {
+			return password, nil
+		}
+	}
+	return "", nil
+}
+
+// ParseHostTokens parses the tokens for hosts from a configuration file,
+// environment variables in the tokens are expanded, e.g.
+//
+//	tokens:
+//	  github.com: $GITHUB_TOKEN
+//	  gitlab.example.com: ${GITLAB_TOKEN}
+func ParseHostTokens(data []byte) (map[string]string, error) {
+	var config struct {
+		Tokens map[string]string `yaml:"tokens"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the tokens: %w", err)
+	}
+	tokens := map[string]string{}
+	for host, token := range config.Tokens {
+		tokens[strings.ToLower(host)] = os.ExpandEnv(token)
+	}
+	return tokens, nil
+}
@@ -0,0 +1,157 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rhd-gitops-example/services/pkg/logging"
+)
+
+func TestTokensToken(t *testing.T) {
+	tokens := &Tokens{
+		Default: "default-token",
+		Hosts: map[string]string{
+			"gitlab.example.com":      "gitlab-token",
+			"git.example.com:8443":    "port-token",
+			"github.example.com":      "ghe-token",
+			"github.example.com:8080": "ghe-port-token",
+		},
+	}
+	tests := []struct {
+		repoURL string
+		want    string
+	}{
+		{"https://github.com/testing/testing.git", "default-token"},
+		{"https://gitlab.example.com/testing/testing.git", "gitlab-token"},
+		{"https://gitlab.example.com:8443/testing/testing.git", "gitlab-token"},
+		{"https://git.example.com:8443/testing/testing.git", "port-token"},
+		{"https://git.example.com/testing/testing.git", "default-token"},
+		{"https://github.example.com:8080/testing/testing.git", "ghe-port-token"},
+		{"file:///tmp/testing.git", ""},
+		{"/tmp/testing", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repoURL, func(rt *testing.T) {
+			got, err := tokens.Token(context.Background(), tt.repoURL)
+			if err != nil {
+				rt.Fatal(err)
+			}
+			if got != tt.want {
+				rt.Errorf("Token(%q) got %q, want %q", tt.repoURL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokensFromCredentialHelpers(t *testing.T) {
+	defer setGitConfigEnv(t, "credential.helper", `!f() { test "$1" = get && echo username=testing && echo password=helper-token; }; f`)()
+	secrets := &logging.Secrets{}
+	tokens := &Tokens{CredentialHelpers: true, Hosts: map[string]string{"gitlab.example.com": "gitlab-token"}, Secrets: secrets}
+
+	for repoURL, want := range map[string]string{
+		"https://github.com/testing/testing.git":         "helper-token",
+		"https://gitlab.example.com/testing/testing.git": "gitlab-token",
+	} {
+		got, err := tokens.Token(context.Background(), repoURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Token(%q) got %q, want %q", repoURL, got, want)
+		}
+	}
+	if got := secrets.Redact("helper-token gitlab-token"); got != "[REDACTED] [REDACTED]" {
+		t.Errorf("got %q, want the tokens added to the secrets", got)
+	}
+}
+
+func TestTokensFromCredentialHelpersWithCancelledContext(t *testing.T) {
+	defer setGitConfigEnv(t, "credential.helper", `!f() { sleep 10; echo password=helper-token; }; f`)()
+	tokens := &Tokens{CredentialHelpers: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := tokens.Token(ctx, "https://github.com/testing/testing.git")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the context's error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("credential helper wasn't killed, took %s", elapsed)
+	}
+}
+
+func TestTokensWithoutCredentials(t *testing.T) {
+	defer setGitConfigEnv(t, "credential.helper", "")()
+	for _, tokens := range []*Tokens{{}, {CredentialHelpers: true}} {
+		got, err := tokens.Token(context.Background(), "https://github.com/testing/testing.git")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "" {
+			t.Errorf("got token %q, want none", got)
+		}
+	}
+}
+
+func TestParseHostTokens(t *testing.T) {
+	defer os.Unsetenv("TEST_GITLAB_TOKEN")
+	os.Setenv("TEST_GITLAB_TOKEN", "gitlab-token")
+	tokens, err := ParseHostTokens([]byte(`tokens:
+  github.com: github-token
+  GitLab.example.com: $TEST_GITLAB_TOKEN
+  git.example.com:8443: ${TEST_GITLAB_TOKEN}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"github.com":           "github-token",
+		"gitlab.example.com":   "gitlab-token",
+		"git.example.com:8443": "gitlab-token",
+	}
+	if diff := cmp.Diff(want, tokens); diff != "" {
+		t.Fatalf("tokens didn't match:\n%s", diff)
+	}
+}
+
+func TestParseHostTokensWithInvalidConfig(t *testing.T) {
+	if _, err := ParseHostTokens([]byte("tokens: [github.com]")); err == nil {
+		t.Fatal("expected an error parsing an invalid config")
+	}
+}
+
+// setGitConfigEnv overrides the git configuration for the test, and disables
+// the global and system configuration, the returned func restores the
+// environment.
+func setGitConfigEnv(t *testing.T, key, value string) func() {
+	t.Helper()
+	env := map[string]string{
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_CONFIG_GLOBAL":   os.DevNull,
+		"GIT_CONFIG_COUNT":    "1",
+		"GIT_CONFIG_KEY_0":    key,
+		"GIT_CONFIG_VALUE_0":  value,
+	}
+	restore := []func(){}
+	for k, v := range env {
+		k := k
+		if old, ok := os.LookupEnv(k); ok {
+			restore = append(restore, func() { os.Setenv(k, old) })
+		} else {
+			restore = append(restore, func() { os.Unsetenv(k) })
+		}
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for _, r := range restore {
+			r()
+		}
+	}
+}
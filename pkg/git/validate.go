@@ -0,0 +1,172 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Problem is a single issue found when validating the layout of a repository.
+type Problem struct {
+	Path    string
+	Message string
+}
+
+// ValidationError is returned when one or more problems were found when
+// validating a repository, all the problems are reported together.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "found %d problem(s) validating the repository:", len(e.Problems))
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  %s: %s", p.Path, p.Message)
+	}
+	return b.String()
+}
+
+// ValidationResult records what was found when validating a repository.
+//
+// Skipped lists the files in a service's folder that are not under
+// base/config, these are not errors, but they will not be promoted.
+type ValidationResult struct {
+	Problems []Problem
+	Skipped  []string
+}
+
+// Err returns a ValidationError if any problems were found, or nil if the
+// repository is valid.
+func (v *ValidationResult) Err() error {
+	if len(v.Problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.Problems}
+}
+
+func (v *ValidationResult) addProblem(filePath, format string, a ...interface{}) {
+	v.Problems = append(v.Problems, Problem{Path: filePath, Message: fmt.Sprintf(format, a...)})
+}
+
+func (v *ValidationResult) merge(o *ValidationResult) {
+	v.Problems = append(v.Problems, o.Problems...)
+	v.Skipped = append(v.Skipped, o.Skipped...)
+}
+
+// ValidateRepository checks that every environment and service in the
+// repository follows the repository's Layout, by default this is
+// environments/<env>/services/<svc>/base/config, and that all the YAML files
+// under the config folders can be parsed.
+//
+// The returned error is only non-nil if the validation itself failed, problems
+// with the repository are recorded in the result.
+func ValidateRepository(r Repo) (*ValidationResult, error) {
+	result := &ValidationResult{}
+	layout := r.Layout()
+	envs, err := layout.Environments(r)
+	if err != nil {
+		if pathErr, ok := err.(*os.PathError); ok && os.IsNotExist(err) {
+			result.addProblem(pathErr.Path, "folder not found")
+			return result, nil
+		}
+		return nil, err
+	}
+	if len(envs) == 0 {
+		result.addProblem(layout.root(), "no environment folders found")
+	}
+	for _, env := range envs {
+		services, err := layout.Services(r, env)
+		if err != nil {
+			if pathErr, ok := err.(*os.PathError); ok && os.IsNotExist(err) {
+				result.addProblem(pathErr.Path, "folder not found")
+				continue
+			}
+			return nil, err
+		}
+		for _, svc := range services {
+			svcResult, err := ValidateService(r, svc, env)
+			if err != nil {
+				return nil, err
+			}
+			result.merge(svcResult)
+		}
+	}
+	return result, nil
+}
+
+// ValidateService checks that the folder for a service in an environment has
+// configuration in the configuration folder, and that all the YAML files there
+// can be parsed.
+//
+// Files in the service's folder that would not be promoted are recorded as
+// skipped, an ErrNotFound error is returned if the service's folder doesn't
+// exist.
+func ValidateService(r Repo, serviceName, environmentName string) (*ValidationResult, error) {
+	result := &ValidationResult{}
+	layout := r.Layout()
+	servicePath := layout.ServicePath(serviceName, environmentName)
+	configFiles := []string{}
+	err := r.Walk(servicePath, func(prefix, name string) error {
+		filePath := path.Join(path.Dir(servicePath), name)
+		if !strings.HasPrefix(filePath, servicePath+"/") {
+			return nil
+		}
+		if layout.pathValidForPromotion(serviceName, filePath, environmentName) {
+			configFiles = append(configFiles, filePath)
+		} else {
+			result.Skipped = append(result.Skipped, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, Errorf(ErrNotFound, "service %s not found in environment %s: %s doesn't exist", serviceName, environmentName, servicePath)
+		}
+		return nil, err
+	}
+	if len(configFiles) == 0 {
+		result.addProblem(layout.ConfigPath(serviceName, environmentName), "no configuration files found")
+	}
+	result.merge(ValidateFiles(r, configFiles...))
+	return result, nil
+}
+
+// ValidateFiles parses each of the named YAML files in the repository,
+// recording a problem for each file that can't be read or parsed.
+//
+// Files that don't have a .yaml or .yml extension, or that don't exist because
+// they were removed, are ignored.
+func ValidateFiles(r Repo, filenames ...string) *ValidationResult {
+	result := &ValidationResult{}
+	for _, filename := range filenames {
+		if !isYAML(filename) {
+			continue
+		}
+		data, err := r.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			result.addProblem(filename, "failed to read file: %s", err)
+			continue
+		}
+		if err := parseYAML(data); err != nil {
+			result.addProblem(filename, "failed to parse YAML: %s", err)
+		}
+	}
+	return result
+}
+
+func isYAML(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// parseYAML decodes every document in a (possibly multi-document) YAML file.
+func parseYAML(data []byte) error {
+	_, err := decodeDocuments(data)
+	return err
+}
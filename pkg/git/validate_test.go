@@ -0,0 +1,102 @@
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateRepository(t *testing.T) {
+	r, cleanup := makeLocalRepository(t, map[string]string{
+		"environments/dev/services/service-a/base/config/deployment.yaml": "kind: Deployment\n",
+		"environments/dev/services/service-a/base/config/service.yaml":    "kind: Service\n---\nkind: Route\n",
+		"environments/dev/services/service-a/base/kustomization.yaml":     "resources: []\n",
+		"environments/staging/services/service-a/base/config/broken.yaml": "kind: [Deployment\n",
+		"environments/staging/services/service-b/overlays/patch.yaml":     "kind: Deployment\n",
+		"environments/prod/apps/service-a/deployment.yaml":                "kind: Deployment\n",
+	})
+	defer cleanup()
+
+	result, err := ValidateRepository(r)
+	assertNoError(t, err)
+
+	wantProblems := []string{
+		"environments/prod/services",
+		"environments/staging/services/service-a/base/config/broken.yaml",
+		"environments/staging/services/service-b/base/config",
+	}
+	if diff := cmp.Diff(wantProblems, problemPaths(result.Problems)); diff != "" {
+		t.Fatalf("validation problems did not match: %s", diff)
+	}
+	wantSkipped := []string{
+		"environments/dev/services/service-a/base/kustomization.yaml",
+		"environments/staging/services/service-b/overlays/patch.yaml",
+	}
+	if diff := cmp.Diff(wantSkipped, result.Skipped); diff != "" {
+		t.Fatalf("skipped files did not match: %s", diff)
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(result.Err(), &validationErr) {
+		t.Fatalf("got error %#v, want a ValidationError", result.Err())
+	}
+}
+
+func TestValidateRepositoryWithNoEnvironments(t *testing.T) {
+	r, cleanup := makeLocalRepository(t, map[string]string{
+		"services/service-a/base/config/deployment.yaml": "kind: Deployment\n",
+	})
+	defer cleanup()
+
+	result, err := ValidateRepository(r)
+	assertNoError(t, err)
+
+	if diff := cmp.Diff([]string{"environments"}, problemPaths(result.Problems)); diff != "" {
+		t.Fatalf("validation problems did not match: %s", diff)
+	}
+}
+
+func TestValidateService(t *testing.T) {
+	r, cleanup := makeLocalRepository(t, map[string]string{
+		"environments/dev/services/service-a/base/config/deployment.yaml": "kind: Deployment\n",
+		"environments/dev/services/service-a/base/config/notes.txt":       "kind: [this isn't YAML",
+	})
+	defer cleanup()
+
+	result, err := ValidateService(r, "service-a", "dev")
+	assertNoError(t, err)
+	assertNoError(t, result.Err())
+
+	_, err = ValidateService(r, "service-b", "dev")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound for a missing service", err)
+	}
+}
+
+func problemPaths(problems []Problem) []string {
+	paths := []string{}
+	for _, p := range problems {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+// makeLocalRepository creates a Repository in a temporary directory containing
+// the files, this doesn't need to be a Git repository for operations that only
+// read and write files.
+func makeLocalRepository(t *testing.T, files map[string]string) (*Repository, func()) {
+	t.Helper()
+	tempDir, cleanup := makeTempDir(t)
+	r, err := NewRepository("https://example.com/testing/gitops.git", tempDir, true, nil)
+	assertNoError(t, err)
+	for name, content := range files {
+		filename := r.repoPath(name)
+		assertNoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		assertNoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+	}
+	return r, cleanup
+}
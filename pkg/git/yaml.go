@@ -0,0 +1,106 @@
+package git
+
+import (
+	"bytes"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeDocuments parses every document in a (possibly multi-document) YAML
+// file, keeping the comments and ordering so that they can be written back.
+func decodeDocuments(data []byte) ([]*yaml.Node, error) {
+	docs := []*yaml.Node{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var n yaml.Node
+		err := dec.Decode(&n)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, &n)
+	}
+}
+
+// encodeDocuments writes the documents back out as a multi-document YAML file.
+func encodeDocuments(docs []*yaml.Node) ([]byte, error) {
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// mappingValue returns the value for the key in a mapping node, or nil if the
+// node is not a mapping or doesn't have the key.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// scalarValue returns the string value for the key in a mapping node, or an
+// empty string if there's no scalar value for the key.
+func scalarValue(n *yaml.Node, key string) string {
+	v := mappingValue(n, key)
+	if v == nil || v.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return v.Value
+}
+
+// setScalarValue sets the string value for the key in a mapping node, adding
+// the key if necessary, or removing it if the value is empty.
+//
+// Returns true if the node was changed.
+func setScalarValue(n *yaml.Node, key, value string) bool {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != key {
+			continue
+		}
+		if value == "" {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return true
+		}
+		v := n.Content[i+1]
+		if v.Kind == yaml.ScalarNode && v.Value == value {
+			return false
+		}
+		*v = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: v.Style}
+		return true
+	}
+	if value == "" {
+		return false
+	}
+	n.Content = append(n.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	return true
+}
+
+// walkNodes calls the callback for every node in the tree, depth first.
+func walkNodes(n *yaml.Node, cb func(*yaml.Node)) {
+	if n == nil {
+		return
+	}
+	cb(n)
+	for _, c := range n.Content {
+		walkNodes(c, cb)
+	}
+}
@@ -0,0 +1,130 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rhd-gitops-example/services/pkg/git"
+)
+
+// KustomizeOutputFile is the file in the destination's configuration folder
+// that the output of kustomize build is written to, for each of the folders
+// promoted from a local service.
+const KustomizeOutputFile = "manifests.yaml"
+
+// kustomizeCommand is the command that builds a kustomization, the directory
+// is appended to it.
+var kustomizeCommand = []string{"kustomize", "build"}
+
+// builder is implemented by Sources that can build their folders with
+// kustomize.
+type builder interface {
+	Build() (map[string][]byte, error)
+}
+
+// buildConfig writes the output of building each of the source's folders with
+// kustomize to the KustomizeOutputFile in the folder's destination.
+func buildConfig(source git.Source, dest git.Destination, configPath string) ([]string, error) {
+	b, ok := source.(builder)
+	if !ok {
+		return nil, errors.New("rendering with kustomize is only supported when promoting from a local service")
+	}
+	built, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	relPaths := make([]string, 0, len(built))
+	for relPath := range built {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+	copied := []string{}
+	for _, relPath := range relPaths {
+		destPath := path.Join(configPath, relPath)
+		if err := dest.WriteFile(bytes.NewReader(built[relPath]), destPath); err != nil {
+			return copied, err
+		}
+		copied = append(copied, destPath)
+	}
+	return copied, nil
+}
+
+// Build renders the service's templated files into a temporary copy of the
+// service, and builds each of the service's paths in the copy with kustomize,
+// so that kustomizations can refer to files outside of the paths.
+//
+// Returns the output of each build, keyed by the KustomizeOutputFile in the
+// path's destination folder.
+func (l *Local) Build() (map[string][]byte, error) {
+	dir, err := ioutil.TempDir("", "kustomize")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a directory to render %s: %w", l.LocalPath, err)
+	}
+	defer os.RemoveAll(dir)
+	if err := renderTree(rendererOf(l), l.LocalPath, dir); err != nil {
+		return nil, err
+	}
+
+	built := map[string][]byte{}
+	for _, p := range l.paths() {
+		out, err := l.kustomize(filepath.Join(dir, filepath.FromSlash(p.Source)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s with kustomize: %w", p.Source, err)
+		}
+		built[path.Join(p.Destination, KustomizeOutputFile)] = out
+	}
+	return built, nil
+}
+
+func (l *Local) kustomize(dir string) ([]byte, error) {
+	args := append(append([]string{}, kustomizeCommand[1:]...), dir)
+	out, err := exec.CommandContext(l.commandContext(), kustomizeCommand[0], args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// renderTree copies the files in src to dst, rendering the templated files,
+// which are written without the TemplateSuffix. Git metadata isn't copied.
+func renderTree(r *Renderer, src, dst string) error {
+	return filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if IsTemplate(name) {
+			target = strings.TrimSuffix(target, TemplateSuffix)
+			if data, err = r.Render(name, data); err != nil {
+				return err
+			}
+		}
+		return ioutil.WriteFile(target, data, 0644)
+	})
+}
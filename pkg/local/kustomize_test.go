@@ -0,0 +1,103 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/test"
+)
+
+func TestCopyConfigBuildsWithKustomize(t *testing.T) {
+	defer fakeKustomize(t, `cat "$0"/kustomization.yaml`)()
+	dir := makeLocalService(t, map[string]string{
+		"base/deployment.yaml":                 "kind: Deployment\n",
+		"overlays/dev/kustomization.yaml.tmpl": "resources:\n- ../../base\nimages:\n- name: service-a\n  digest: {{ .ImageDigest }}\n",
+		"overlays/prod/kustomization.yaml":     "resources:\n- ../../base\n",
+	})
+	defer os.RemoveAll(dir)
+	l := &Local{
+		LocalPath: dir,
+		Paths:     []Path{{Source: "overlays/dev"}, {Source: "overlays/prod", Destination: "prod"}},
+		Renderer:  &Renderer{ImageDigest: "sha256:abcdef", Mode: RenderKustomize},
+	}
+	f, err := git.NewFilter(nil, []string{"prod/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &mockDestination{}
+
+	copied, err := CopyConfig("service-a", FilterConfig(l, f), d, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"environments/dev/services/service-a/base/config/manifests.yaml"}
+	if diff := cmp.Diff(want, copied); diff != "" {
+		t.Fatalf("copied files did not match: %s", diff)
+	}
+	if diff := cmp.Diff("resources:\n- ../../base\nimages:\n- name: service-a\n  digest: sha256:abcdef\n", d.contents[want[0]]); diff != "" {
+		t.Fatalf("built file did not match: %s", diff)
+	}
+}
+
+func TestCopyConfigReportsKustomizeFailures(t *testing.T) {
+	defer fakeKustomize(t, `echo "Error: missing kustomization" >&2; exit 1`)()
+	dir := makeLocalService(t, map[string]string{"config/deployment.yaml": "kind: Deployment\n"})
+	defer os.RemoveAll(dir)
+	l := &Local{LocalPath: dir, Renderer: &Renderer{Mode: RenderKustomize}}
+
+	_, err := CopyConfig("service-a", l, &mockDestination{}, "dev")
+	test.AssertErrorMatch(t, "failed to build config with kustomize: exit status 1: Error: missing kustomization", err)
+}
+
+func TestCopyConfigBuildsOnlyLocalServices(t *testing.T) {
+	s := &mockSource{localPath: "/tmp/testing"}
+	s.addFile("config/my-file.yaml")
+
+	_, err := buildConfig(s, &mockDestination{}, "environments/dev/services/service-a/base/config")
+	test.AssertErrorMatch(t, "rendering with kustomize is only supported when promoting from a local service", err)
+}
+
+func TestParseRenderMode(t *testing.T) {
+	for _, s := range []string{"", "templates", "Kustomize"} {
+		if _, err := ParseRenderMode(s); err != nil {
+			t.Errorf("ParseRenderMode(%q) failed: %s", s, err)
+		}
+	}
+	_, err := ParseRenderMode("helm")
+	test.AssertErrorMatch(t, `unknown render mode "helm"`, err)
+}
+
+// fakeKustomize replaces the kustomize command with a shell script for the
+// test, the directory that's built is $0, and returns a func that restores it.
+func fakeKustomize(t *testing.T, script string) func() {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	old := kustomizeCommand
+	kustomizeCommand = []string{"sh", "-c", script}
+	return func() { kustomizeCommand = old }
+}
+
+func makeLocalService(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir(os.TempDir(), "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
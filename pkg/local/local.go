@@ -1,30 +1,102 @@
 package local
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/logging"
 )
 
+// Path maps a folder in a local service to a folder under the service's
+// configuration folder in the destination, an empty Destination is the
+// configuration folder itself.
+type Path struct {
+	Source      string
+	Destination string
+}
+
+// DefaultPaths promote the files in the service's config folder.
+var DefaultPaths = []Path{{Source: "config"}}
+
 type Local struct {
 	LocalPath string
-	Debug     bool
-	Logger    func(fmt string, v ...interface{})
+	Paths     []Path
+	Renderer  *Renderer
+	Logger    logging.Logger
+
+	ctx context.Context
+}
+
+// ParsePaths parses a list of folders to promote from a local service, each
+// folder can be mapped to a folder in the destination with a ":" e.g.
+// "deploy/k8s" or "deploy/db:database".
+func ParsePaths(specs []string) ([]Path, error) {
+	paths := []Path{}
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 2)
+		p := Path{Source: cleanPath(parts[0])}
+		if len(parts) == 2 {
+			p.Destination = cleanPath(parts[1])
+		}
+		if p.Destination == "." {
+			p.Destination = ""
+		}
+		if p.Source == "." || strings.HasPrefix(p.Source, "..") || strings.HasPrefix(p.Destination, "..") {
+			return nil, fmt.Errorf("invalid path %q, paths must be within the service", spec)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+func cleanPath(p string) string {
+	return strings.Trim(path.Clean(filepath.ToSlash(p)), "/")
 }
 
 // CopyConfig takes the name of a service and a Source local service root path to be copied to a Destination.
 //
-// Only files under /path/to/local/repo/config/* are copied to the destination /environments/envName//services/[serviceName]/base/config/*
-// Accepts an override target folder as well, in the event we wish to place the code at a given directory
-// This directory is prepended to the destination path
+// Only files under the local service's paths, by default /path/to/local/repo/config/*, are copied to the service's
+// configuration folder in the destination's layout, for the default layout this is
+// /environments/envName/services/[serviceName]/base/config/*
+//
+// Files with the TemplateSuffix are rendered, and written to the destination
+// without the suffix. If the source's Renderer is in the RenderKustomize mode,
+// the output of building each of the source's paths with kustomize is written
+// to the destination instead.
+//
 // Returns the list of files that were copied, and possibly an error.
 func CopyConfig(serviceName string, source git.Source, dest git.Destination, environmentName string) ([]string, error) {
+	layout := git.DefaultLayout
+	if r, ok := dest.(git.Repo); ok {
+		layout = r.Layout()
+	}
+	if rendererOf(source).Mode == RenderKustomize {
+		return buildConfig(source, dest, layout.ConfigPath(serviceName, environmentName))
+	}
 	copied := []string{}
 	err := source.Walk("", func(prefix, name string) error {
+		relPath, ok := destinationPath(source, name)
+		if !ok {
+			return nil
+		}
 		sourcePath := filepath.Join(prefix, name)
-		destPath := pathForDestServiceConfig(serviceName, name, environmentName)
+		destPath := path.Join(layout.ConfigPath(serviceName, environmentName), relPath)
+		if IsTemplate(destPath) {
+			destPath = strings.TrimSuffix(destPath, TemplateSuffix)
+			err := renderFile(rendererOf(source), sourcePath, dest, destPath)
+			if err == nil {
+				copied = append(copied, destPath)
+			}
+			return err
+		}
 		err := dest.CopyFile(sourcePath, destPath)
 		if err == nil {
 			copied = append(copied, destPath)
@@ -34,25 +106,117 @@ func CopyConfig(serviceName string, source git.Source, dest git.Destination, env
 	return copied, err
 }
 
-// pathForDestServiceConfig defines where in a 'gitops' repository the config
-// for a given service should live.
-func pathForDestServiceConfig(serviceName, name, environmentName string) string {
-	return filepath.Join("environments", environmentName, "services", serviceName, "base", name)
+func renderFile(r *Renderer, sourcePath string, dest git.Destination, destPath string) error {
+	data, err := ioutil.ReadFile(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", sourcePath, err)
+	}
+	rendered, err := r.Render(sourcePath, data)
+	if err != nil {
+		return err
+	}
+	return dest.WriteFile(bytes.NewReader(rendered), destPath)
+}
+
+// rendererOf returns the Renderer for the source, or a Renderer with no values
+// if the source doesn't have one.
+func rendererOf(source git.Source) *Renderer {
+	if r, ok := source.(interface{ GetRenderer() *Renderer }); ok && r.GetRenderer() != nil {
+		return r.GetRenderer()
+	}
+	return &Renderer{Values: map[string]interface{}{}}
+}
+
+// pathMapper is implemented by Sources that can map the names of the files
+// they walk to paths in the destination's configuration folder.
+type pathMapper interface {
+	DestinationPath(name string) (string, bool)
+}
+
+// destinationPath returns the path relative to the destination's
+// configuration folder for a file walked in the source.
+func destinationPath(source git.Source, name string) (string, bool) {
+	if m, ok := source.(pathMapper); ok {
+		return m.DestinationPath(name)
+	}
+	return DefaultPaths[0].destinationPath(filepath.ToSlash(name))
+}
+
+func (p Path) destinationPath(name string) (string, bool) {
+	if !strings.HasPrefix(name, p.Source+"/") {
+		return "", false
+	}
+	return path.Join(p.Destination, strings.TrimPrefix(name, p.Source+"/")), true
+}
+
+func (l *Local) paths() []Path {
+	if len(l.Paths) == 0 {
+		return DefaultPaths
+	}
+	return l.Paths
 }
 
+// Walk calls the callback for each file in the service's paths, the names are
+// relative to the LocalPath.
+//
+// Files in more than one of the paths are only walked once.
 func (l *Local) Walk(_ string, cb func(prefix, name string) error) error {
-	base := filepath.Join(l.LocalPath, "config")
-	prefix := filepath.Dir(base) + string(filepath.Separator)
-	return filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+	prefix := filepath.Clean(l.LocalPath) + string(filepath.Separator)
+	seen := map[string]bool{}
+	for _, p := range l.paths() {
+		base := filepath.Join(l.LocalPath, filepath.FromSlash(p.Source))
+		err := filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() || seen[path] {
+				return nil
+			}
+			seen[path] = true
+			return cb(prefix, strings.TrimPrefix(path, prefix))
+		})
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		if info.IsDir() {
-			return nil
+// DestinationPath returns the path in the destination's configuration folder
+// for a file walked in the service, using the path with the longest matching
+// source folder.
+func (l *Local) DestinationPath(name string) (string, bool) {
+	name = filepath.ToSlash(name)
+	var found *Path
+	for i, p := range l.paths() {
+		if strings.HasPrefix(name, p.Source+"/") && (found == nil || len(p.Source) > len(found.Source)) {
+			found = &l.paths()[i]
 		}
-		return cb(prefix, strings.TrimPrefix(path, prefix))
-	})
+	}
+	if found == nil {
+		return "", false
+	}
+	return found.destinationPath(name)
+}
+
+// SetContext sets the context that commands, e.g. kustomize, are run with, the
+// commands are killed if it's cancelled.
+func (l *Local) SetContext(ctx context.Context) {
+	l.ctx = ctx
+}
+
+// commandContext returns the context that commands are run with.
+func (l *Local) commandContext() context.Context {
+	if l.ctx == nil {
+		return context.Background()
+	}
+	return l.ctx
+}
+
+// GetRenderer returns the Renderer used for templated files.
+func (l *Local) GetRenderer() *Renderer {
+	return l.Renderer
 }
 
 // GetName - we're using a directory that may not be a git repo, all we know is our path
@@ -62,3 +226,51 @@ func (l *Local) GetName() string {
 	name := strings.ReplaceAll(path, string(filepath.Separator), "-")
 	return name
 }
+
+// FilterConfig wraps a Source so that only the files that match the filter are
+// promoted, the files are matched using their paths in the destination's
+// configuration folder.
+func FilterConfig(source git.Source, f *git.Filter) git.Source {
+	return &filteredSource{Source: source, filter: f}
+}
+
+type filteredSource struct {
+	git.Source
+	filter *git.Filter
+}
+
+func (s *filteredSource) Walk(base string, cb func(prefix, name string) error) error {
+	return s.Source.Walk(base, func(prefix, name string) error {
+		if relPath, ok := destinationPath(s.Source, name); ok && !s.filter.Match(relPath) {
+			return nil
+		}
+		return cb(prefix, name)
+	})
+}
+
+func (s *filteredSource) GetRenderer() *Renderer {
+	return rendererOf(s.Source)
+}
+
+func (s *filteredSource) DestinationPath(name string) (string, bool) {
+	return destinationPath(s.Source, name)
+}
+
+// Build builds the wrapped Source with kustomize, only the output for the
+// folders that match the filter is returned.
+func (s *filteredSource) Build() (map[string][]byte, error) {
+	b, ok := s.Source.(builder)
+	if !ok {
+		return nil, errors.New("rendering with kustomize is only supported when promoting from a local service")
+	}
+	built, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	for relPath := range built {
+		if !s.filter.Match(relPath) {
+			delete(built, relPath)
+		}
+	}
+	return built, nil
+}
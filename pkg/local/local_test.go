@@ -1,8 +1,9 @@
 package local
 
 import (
-	"errors"
 	"io"
+	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 	"reflect"
@@ -10,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/rhd-gitops-example/services/pkg/git"
 )
 
 func TestCopyConfig(t *testing.T) {
@@ -95,6 +97,7 @@ func (s *mockSource) addFile(name string) {
 
 type mockDestination struct {
 	written   []string
+	contents  map[string]string
 	copyError error
 }
 
@@ -110,7 +113,16 @@ func (d *mockDestination) CopyFile(src, dst string) error {
 }
 
 func (d *mockDestination) WriteFile(src io.Reader, dst string) error {
-	return errors.New("not implemented just now")
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	if d.contents == nil {
+		d.contents = map[string]string{}
+	}
+	d.written = append(d.written, dst)
+	d.contents[dst] = string(b)
+	return nil
 }
 
 func (d *mockDestination) assertFilesWritten(t *testing.T, want []string) {
@@ -118,3 +130,78 @@ func (d *mockDestination) assertFilesWritten(t *testing.T, want []string) {
 		t.Fatalf("written files do not match: %s", diff)
 	}
 }
+
+func TestCopyConfigWithFilter(t *testing.T) {
+	s := &mockSource{localPath: "/tmp/testing"}
+	for _, f := range []string{"config/my-file.yaml", "config/configmap-env.yaml", "config/db.secret.yaml"} {
+		s.addFile(f)
+	}
+	d := &mockDestination{}
+	f, err := git.NewFilter(nil, []string{"configmap-env.yaml", "*.secret.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := CopyConfig("service-a", FilterConfig(s, f), d, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"environments/dev/services/service-a/base/config/my-file.yaml"}
+	d.assertFilesWritten(t, want)
+	if !reflect.DeepEqual(want, copied) {
+		t.Fatalf("failed to copy the files, got %#v, want %#v", copied, want)
+	}
+}
+
+func TestParsePaths(t *testing.T) {
+	paths, err := ParsePaths([]string{"deploy/k8s/", ".openshift:openshift", "./db:/database"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Path{{Source: "deploy/k8s"}, {Source: ".openshift", Destination: "openshift"}, {Source: "db", Destination: "database"}}
+	if diff := cmp.Diff(want, paths); diff != "" {
+		t.Fatalf("paths did not match: %s", diff)
+	}
+
+	for _, spec := range []string{"", "../config", "config:../other"} {
+		if _, err := ParsePaths([]string{spec}); err == nil {
+			t.Errorf("ParsePaths(%q) expected an error", spec)
+		}
+	}
+}
+
+func TestCopyConfigWithPaths(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"config/ignored.yaml", "deploy/k8s/deployment.yaml", "deploy/k8s/db/statefulset.yaml", ".openshift/route.yaml"} {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte("kind: Test\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := &Local{LocalPath: dir, Paths: []Path{{Source: "deploy/k8s"}, {Source: "deploy/k8s/db", Destination: "database"}, {Source: ".openshift", Destination: "openshift"}}}
+	d := &mockDestination{}
+	f, err := git.NewFilter(nil, []string{"openshift/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := CopyConfig("service-a", FilterConfig(l, f), d, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"environments/dev/services/service-a/base/config/database/statefulset.yaml",
+		"environments/dev/services/service-a/base/config/deployment.yaml",
+	}
+	d.assertFilesWritten(t, want)
+	if !reflect.DeepEqual(want, copied) {
+		t.Fatalf("failed to copy the files, got %#v, want %#v", copied, want)
+	}
+}
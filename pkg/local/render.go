@@ -0,0 +1,134 @@
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateSuffix is the suffix of files in a local service that are rendered
+// as Go templates before they're promoted, the suffix is removed from the
+// promoted file e.g. deployment.yaml.tmpl is promoted as deployment.yaml.
+const TemplateSuffix = ".tmpl"
+
+// RenderMode controls how the files in a local service are rendered before
+// they're promoted.
+type RenderMode string
+
+const (
+	// RenderTemplates promotes the service's files, with the templated files
+	// rendered.
+	RenderTemplates RenderMode = "templates"
+	// RenderKustomize promotes the output of kustomize build for each of the
+	// service's folders, the templated files are rendered before the build.
+	RenderKustomize RenderMode = "kustomize"
+)
+
+// ParseRenderMode returns the RenderMode for a string, or an error if the mode
+// is not known, templates are rendered if the string is empty.
+func ParseRenderMode(s string) (RenderMode, error) {
+	switch m := RenderMode(strings.ToLower(s)); m {
+	case RenderTemplates, RenderKustomize:
+		return m, nil
+	case "":
+		return RenderTemplates, nil
+	}
+	return "", fmt.Errorf("unknown render mode %q, must be one of templates or kustomize", s)
+}
+
+// Renderer renders the templated files in a local service.
+//
+// Templates can refer to the values with {{ .Values.image.tag }}, and to the
+// digest of the image that was built with {{ .ImageDigest }}.
+type Renderer struct {
+	Values      map[string]interface{}
+	ImageDigest string
+	Mode        RenderMode
+}
+
+// NewRenderer creates and returns a new Renderer, the values are read from
+// the values files in order, and then the key=value pairs in set are applied,
+// keys can be nested e.g. image.tag=v1.
+//
+// The image digest is read from the imageDigestFile if it's not empty, this can
+// be a Tekton task result.
+func NewRenderer(valuesFiles, set []string, imageDigestFile string) (*Renderer, error) {
+	r := &Renderer{Values: map[string]interface{}{}}
+	for _, filename := range valuesFiles {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values file %s: %w", filename, err)
+		}
+		values := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse values file %s: %w", filename, err)
+		}
+		mergeValues(r.Values, values)
+	}
+	for _, s := range set {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid value %q, must be key=value", s)
+		}
+		setValue(r.Values, strings.Split(parts[0], "."), parts[1])
+	}
+	if imageDigestFile != "" {
+		data, err := ioutil.ReadFile(imageDigestFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image digest file %s: %w", imageDigestFile, err)
+		}
+		r.ImageDigest = strings.TrimSpace(string(data))
+	}
+	return r, nil
+}
+
+// IsTemplate returns true if the file should be rendered before it's
+// promoted.
+func IsTemplate(name string) bool {
+	return strings.HasSuffix(name, TemplateSuffix)
+}
+
+// Render executes the template, the name is used in error messages.
+func (r *Renderer) Render(name string, data []byte) ([]byte, error) {
+	tmpl, err := template.New(path.Base(name)).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, r); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return b.Bytes(), nil
+}
+
+// mergeValues recursively merges the values from src into dst.
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				mergeValues(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// setValue sets the value for a nested key, replacing any value that isn't a
+// map along the way.
+func setValue(values map[string]interface{}, keys []string, value string) {
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := values[k].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			values[k] = next
+		}
+		values = next
+	}
+	values[keys[len(keys)-1]] = value
+}
@@ -0,0 +1,94 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewRenderer(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valuesFile := filepath.Join(dir, "values.yaml")
+	digestFile := filepath.Join(dir, "IMAGE_DIGEST")
+	if err := ioutil.WriteFile(valuesFile, []byte("replicas: 2\nimage:\n  repository: quay.io/example/service-a\n  tag: v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(digestFile, []byte("sha256:abcdef\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRenderer([]string{valuesFile}, []string{"image.tag=v2", "env=dev=1"}, digestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Renderer{
+		Values: map[string]interface{}{
+			"replicas": 2,
+			"image":    map[string]interface{}{"repository": "quay.io/example/service-a", "tag": "v2"},
+			"env":      "dev=1",
+		},
+		ImageDigest: "sha256:abcdef",
+	}
+	if diff := cmp.Diff(want, r); diff != "" {
+		t.Fatalf("renderer did not match: %s", diff)
+	}
+}
+
+func TestNewRendererWithInvalidValue(t *testing.T) {
+	_, err := NewRenderer(nil, []string{"image.tag"}, "")
+	if err == nil || err.Error() != `invalid value "image.tag", must be key=value` {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	r := &Renderer{Values: map[string]interface{}{"image": map[string]interface{}{"repository": "quay.io/example/service-a"}}, ImageDigest: "sha256:abcdef"}
+
+	out, err := r.Render("deployment.yaml.tmpl", []byte("image: {{ .Values.image.repository }}@{{ .ImageDigest }}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("image: quay.io/example/service-a@sha256:abcdef\n", string(out)); diff != "" {
+		t.Fatalf("rendered template did not match: %s", diff)
+	}
+
+	_, err = r.Render("deployment.yaml.tmpl", []byte("replicas: {{ .Values.replicas }}\n"))
+	if err == nil {
+		t.Fatal("expected an error rendering a missing value")
+	}
+}
+
+func TestCopyConfigRendersTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config", "kustomization.yaml.tmpl"), []byte("images:\n- name: service-a\n  digest: {{ .ImageDigest }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := &Local{LocalPath: dir, Renderer: &Renderer{ImageDigest: "sha256:abcdef"}}
+	d := &mockDestination{}
+
+	copied, err := CopyConfig("service-a", l, d, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"environments/dev/services/service-a/base/config/kustomization.yaml"}
+	if diff := cmp.Diff(want, copied); diff != "" {
+		t.Fatalf("copied files did not match: %s", diff)
+	}
+	if diff := cmp.Diff("images:\n- name: service-a\n  digest: sha256:abcdef\n", d.contents[want[0]]); diff != "" {
+		t.Fatalf("rendered file did not match: %s", diff)
+	}
+}
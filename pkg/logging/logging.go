@@ -0,0 +1,231 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger logs messages at levels, with fields of context, e.g. the service
+// being promoted.
+//
+// The fields are alternating keys and values, e.g.
+//
+//	logger.Info("created pull request", "number", pr.Number)
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+	// With returns a Logger that includes the fields in every message.
+	With(keysAndValues ...interface{}) Logger
+}
+
+// Level is the severity of a message, messages below the level of a Logger
+// are not logged.
+type Level int
+
+// The levels that messages are logged at.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses the name of a level, e.g. "debug".
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, must be one of %s", s, strings.Join(levelNames, ", "))
+}
+
+// Format is how messages are written.
+type Format string
+
+// The formats that messages can be written in.
+const (
+	// FormatText writes a line per message, with the fields as key=value
+	// pairs.
+	FormatText Format = "text"
+	// FormatJSON writes a JSON object per line, with the time, level and msg,
+	// followed by the fields.
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses the name of a format, e.g. "json".
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatText, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown log format %q, must be %s or %s", s, FormatText, FormatJSON)
+}
+
+// output is shared by a Logger and the Loggers created from it with With.
+type output struct {
+	mu      sync.Mutex
+	w       io.Writer
+	format  Format
+	level   Level
+	secrets *Secrets
+	now     func() time.Time
+}
+
+type logger struct {
+	out    *output
+	fields []interface{}
+}
+
+// New creates and returns a Logger that writes the messages at the level, and
+// above, to w in the format.
+//
+// The secrets, and any credentials in URLs, are redacted from everything that's
+// written, secrets can be nil.
+func New(w io.Writer, format Format, level Level, secrets *Secrets) Logger {
+	return &logger{out: &output{w: w, format: format, level: level, secrets: secrets, now: time.Now}}
+}
+
+// Discard returns a Logger that doesn't log anything.
+func Discard() Logger {
+	return New(ioutil.Discard, FormatText, LevelError+1, nil)
+}
+
+func (l *logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.log(LevelDebug, msg, keysAndValues)
+}
+
+func (l *logger) Info(msg string, keysAndValues ...interface{}) {
+	l.log(LevelInfo, msg, keysAndValues)
+}
+
+func (l *logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log(LevelWarn, msg, keysAndValues)
+}
+
+func (l *logger) Error(msg string, keysAndValues ...interface{}) {
+	l.log(LevelError, msg, keysAndValues)
+}
+
+func (l *logger) With(keysAndValues ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	return &logger{out: l.out, fields: append(fields, keysAndValues...)}
+}
+
+func (l *logger) log(level Level, msg string, keysAndValues []interface{}) {
+	if level < l.out.level {
+		return
+	}
+	fields := append(append([]interface{}{}, l.fields...), keysAndValues...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, nil)
+	}
+	var b bytes.Buffer
+	if l.out.format == FormatJSON {
+		writeJSON(&b, l.out.now(), level, msg, fields)
+	} else {
+		writeText(&b, l.out.now(), level, msg, fields)
+	}
+	line := l.out.secrets.Redact(b.String())
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = io.WriteString(l.out.w, line)
+}
+
+func writeText(b *bytes.Buffer, t time.Time, level Level, msg string, fields []interface{}) {
+	b.WriteString(t.Format("2006/01/02 15:04:05 "))
+	b.WriteString(strings.ToUpper(level.String()))
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteString(" ")
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteString("=")
+		b.WriteString(quoteText(stringValue(fields[i+1])))
+	}
+	b.WriteString("\n")
+}
+
+// quoteText quotes values that would otherwise be ambiguous in the text
+// format.
+func quoteText(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func writeJSON(b *bytes.Buffer, t time.Time, level Level, msg string, fields []interface{}) {
+	b.WriteString("{")
+	writeJSONField(b, "time", t.Format(time.RFC3339))
+	b.WriteString(",")
+	writeJSONField(b, "level", level.String())
+	b.WriteString(",")
+	writeJSONField(b, "msg", msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteString(",")
+		writeJSONField(b, fmt.Sprint(fields[i]), jsonValue(fields[i+1]))
+	}
+	b.WriteString("}\n")
+}
+
+func writeJSONField(b *bytes.Buffer, key string, value interface{}) {
+	b.Write(marshal(key))
+	b.WriteString(":")
+	b.Write(marshal(value))
+}
+
+// marshal encodes the value as JSON, without escaping HTML, so that URLs are
+// readable, and can be redacted.
+func marshal(v interface{}) []byte {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		b.Reset()
+		_ = enc.Encode(fmt.Sprint(v))
+	}
+	return bytes.TrimRight(b.Bytes(), "\n")
+}
+
+// jsonValue returns the value to encode, errors and Stringers are encoded as
+// their strings.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error, fmt.Stringer:
+		return stringValue(v)
+	}
+	return v
+}
+
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,221 @@
+package promotion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	"github.com/rhd-gitops-example/services/pkg/git"
+)
+
+func TestParallelPromotionsShareCache(t *testing.T) {
+	const services = 4
+	tempDir, err := ioutil.TempDir(os.TempDir(), "promote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	files := map[string]string{}
+	for i := 0; i < services; i++ {
+		files[fmt.Sprintf("environments/dev/services/service-%d/base/config/configmap.yaml", i)] = fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: service-%d\n", i)
+	}
+	from := EnvLocation{RepoPath: mustMakeBareRepository(t, tempDir, "dev", files), Branch: "master"}
+	to := EnvLocation{RepoPath: mustMakeBareRepository(t, tempDir, "staging", map[string]string{"environments/staging/.gitkeep": ""}), Branch: "master"}
+	author := &git.Author{Name: "Testing User", Email: "testing@example.com"}
+	cacheDir := filepath.Join(tempDir, "cache")
+
+	var wg sync.WaitGroup
+	errs := make([]error, services)
+	for i := 0; i < services; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sm := New(cacheDir, author)
+			sm.clientFactory = func(s, ty, r string, v bool) *scm.Client {
+				client, _ := fakescm.NewDefault()
+				return client
+			}
+			service := fmt.Sprintf("service-%d", i)
+			errs[i] = sm.Promote(context.Background(), service, from, to, "promote-"+service, "", false)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("promotion of service-%d failed: %s", i, err)
+		}
+	}
+	for i := 0; i < services; i++ {
+		branch := fmt.Sprintf("promote-service-%d", i)
+		out := mustRunGit(t, strings.TrimPrefix(to.RepoPath, "file://"), "show", branch+":"+fmt.Sprintf("environments/staging/services/service-%d/base/config/configmap.yaml", i))
+		if want := fmt.Sprintf("name: service-%d", i); !strings.Contains(out, want) {
+			t.Errorf("branch %s got %q, want it to contain %q", branch, out, want)
+		}
+	}
+	mirrors, err := ioutil.ReadDir(filepath.Join(cacheDir, "mirrors"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mirrorCount int
+	for _, m := range mirrors {
+		if m.IsDir() {
+			mirrorCount++
+		}
+	}
+	if mirrorCount != 2 {
+		t.Errorf("got %d mirrors, want 2", mirrorCount)
+	}
+	for _, cache := range []string{sourceCache, destinationCache} {
+		checkouts, err := ioutil.ReadDir(filepath.Join(cacheDir, cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(checkouts) != 0 {
+			t.Errorf("got %d checkouts in the %s cache, want them all deleted", len(checkouts), cache)
+		}
+	}
+}
+
+func TestPromoteDeletesCheckoutsWhenCheckoutFails(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "promote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	from := EnvLocation{RepoPath: mustMakeBareRepository(t, tempDir, "dev", map[string]string{
+		"environments/dev/services/service-a/base/config/configmap.yaml": "kind: ConfigMap\nmetadata:\n  name: service-a\n",
+	}), Branch: "master"}
+	to := EnvLocation{RepoPath: mustMakeBareRepository(t, tempDir, "staging", map[string]string{"environments/staging/.gitkeep": ""}), Branch: "master"}
+	missingFrom, missingTo := from, to
+	missingFrom.Branch, missingTo.Branch = "missing", "missing"
+	cacheDir := filepath.Join(tempDir, "cache")
+	sm := New(cacheDir, &git.Author{Name: "Testing User", Email: "testing@example.com"})
+
+	for _, locations := range [][2]EnvLocation{{missingFrom, to}, {from, missingTo}} {
+		if err := sm.Promote(context.Background(), "service-a", locations[0], locations[1], "", "", false); err == nil {
+			t.Fatalf("promotion from %v to %v didn't fail", locations[0], locations[1])
+		}
+	}
+
+	for _, cache := range []string{sourceCache, destinationCache} {
+		checkouts, err := ioutil.ReadDir(filepath.Join(cacheDir, cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(checkouts) != 0 {
+			t.Errorf("got %d checkouts in the %s cache, want them all deleted", len(checkouts), cache)
+		}
+	}
+}
+
+func TestPromoteMissingServiceIsNotFound(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "promote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	from := EnvLocation{RepoPath: mustMakeBareRepository(t, tempDir, "dev", map[string]string{
+		"environments/dev/services/service-a/base/config/configmap.yaml": "kind: ConfigMap\nmetadata:\n  name: service-a\n",
+	}), Branch: "master"}
+	to := EnvLocation{RepoPath: mustMakeBareRepository(t, tempDir, "staging", map[string]string{"environments/staging/.gitkeep": ""}), Branch: "master"}
+	sm := New(filepath.Join(tempDir, "cache"), &git.Author{Name: "Testing User", Email: "testing@example.com"})
+
+	err = sm.Promote(context.Background(), "service-b", from, to, "", "", false)
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrValidation) {
+		t.Fatalf("got %v, want ErrNotFound for a missing service", err)
+	}
+}
+
+func TestPromotionDoesNotLeakToken(t *testing.T) {
+	const token = "my-secret-token-1234"
+	tempDir, err := ioutil.TempDir(os.TempDir(), "promote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	from := EnvLocation{RepoPath: mustMakeBareRepository(t, tempDir, "dev", map[string]string{
+		"environments/dev/services/service-a/base/config/configmap.yaml": "kind: ConfigMap\nmetadata:\n  name: service-a\n",
+	}), Branch: "master"}
+	staging := EnvLocation{RepoPath: mustMakeBareRepository(t, tempDir, "staging", map[string]string{"environments/staging/.gitkeep": ""}), Branch: "master"}
+	unreachable := EnvLocation{RepoPath: "https://127.0.0.1:1/testing/staging.git", Branch: "master"}
+	author := &git.Author{Name: "Testing User", Email: "testing@example.com"}
+	cacheDir := filepath.Join(tempDir, "cache")
+	sm := New(cacheDir, author, WithTokens(&git.Tokens{Default: token}))
+	sm.clientFactory = func(s, ty, r string, v bool) *scm.Client {
+		client, _ := fakescm.NewDefault()
+		return client
+	}
+
+	if err := sm.Promote(context.Background(), "service-a", from, staging, "", "", true); err != nil {
+		t.Fatal(err)
+	}
+	err = sm.Promote(context.Background(), "service-a", from, unreachable, "", "", true)
+	if err == nil {
+		t.Fatal("promotion to an unreachable repository didn't fail")
+	}
+	if strings.Contains(err.Error(), token) {
+		t.Fatalf("token found in the error: %s", err)
+	}
+	err = filepath.Walk(cacheDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if strings.Contains(p, token) {
+			t.Errorf("token found in the path %s", p)
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), token) {
+			t.Errorf("token found in %s", p)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mustMakeBareRepository creates a bare repository with the files committed to
+// the master branch, and returns a URL for it.
+func mustMakeBareRepository(t *testing.T, dir, name string, files map[string]string) string {
+	t.Helper()
+	work := filepath.Join(dir, "work", name)
+	for filename, body := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(work, filename)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(work, filename), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustRunGit(t, work, "init")
+	mustRunGit(t, work, "checkout", "-b", "master")
+	mustRunGit(t, work, "add", ".")
+	mustRunGit(t, work, "-c", "user.name=Testing User", "-c", "user.email=testing@example.com", "commit", "-m", "initial commit")
+	bare := filepath.Join(dir, "upstream", name+".git")
+	mustRunGit(t, dir, "clone", "--bare", work, bare)
+	return "file://" + bare
+}
+
+func mustRunGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %s (%s)", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
@@ -12,6 +12,7 @@ type EnvLocation struct {
 	RepoPath string // URL or local path
 	Branch   string
 	Folder   string
+	Ref      string // commit SHA or tag on the Branch, the head if empty
 }
 
 func (env EnvLocation) IsLocal() (bool, error) {
@@ -42,6 +43,9 @@ func (env EnvLocation) String() string {
 	}
 
 	var b strings.Builder
+	if env.Ref != "" {
+		fmt.Fprintf(&b, "ref %s on ", env.Ref)
+	}
 	fmt.Fprintf(&b, "branch %s in %s", env.Branch, repoName)
 	if env.Folder != "" {
 		fmt.Fprintf(&b, " (environment folder %s)", env.Folder)
@@ -0,0 +1,24 @@
+package promotion
+
+import (
+	"errors"
+
+	"github.com/rhd-gitops-example/services/pkg/git"
+)
+
+// The kinds of promotion failure, the errors returned by the ServiceManager
+// can be checked for them with errors.Is, e.g.
+//
+//	if errors.Is(err, promotion.ErrNoChanges) {
+//		// the destination is already up to date
+//	}
+var (
+	ErrAuth           = git.ErrAuth
+	ErrNotFound       = git.ErrNotFound
+	ErrNoChanges      = git.ErrNoChanges
+	ErrConflict       = git.ErrConflict
+	ErrRemoteRejected = git.ErrRemoteRejected
+	// ErrValidation is a service, or promoted configuration, that failed
+	// validation.
+	ErrValidation = errors.New("validation failed")
+)
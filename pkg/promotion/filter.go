@@ -0,0 +1,54 @@
+package promotion
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/local"
+)
+
+// filterService wraps the source and destination so that only the files that
+// match the include and exclude patterns, and the patterns in the
+// .promotionignore files in the source and destination service folders, are
+// promoted.
+func (s *ServiceManager) filterService(serviceName string, source git.Source, destination git.Repo, from EnvLocation, sourceEnvironment, destinationEnvironment string) (git.Source, git.Repo, error) {
+	exclude := append([]string{}, s.exclude...)
+
+	var sourceIgnored []string
+	if repo, ok := source.(git.Repo); ok {
+		ignored, err := git.ServiceIgnorePatterns(repo, serviceName, sourceEnvironment)
+		if err != nil {
+			return nil, nil, err
+		}
+		sourceIgnored = ignored
+	} else {
+		ignorePath := filepath.Join(from.RepoPath, git.IgnoreFile)
+		data, err := ioutil.ReadFile(ignorePath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", ignorePath, err)
+		}
+		sourceIgnored = git.ParseIgnoreFile(data)
+	}
+	destIgnored, err := git.ServiceIgnorePatterns(destination, serviceName, destinationEnvironment)
+	if err != nil {
+		return nil, nil, err
+	}
+	exclude = append(append(exclude, sourceIgnored...), destIgnored...)
+
+	filter, err := git.NewFilter(s.include, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+	if filter.Empty() {
+		return source, destination, nil
+	}
+	if repo, ok := source.(git.Repo); ok {
+		source = git.FilterService(repo, serviceName, sourceEnvironment, filter)
+	} else {
+		source = local.FilterConfig(source, filter)
+	}
+	return source, git.FilterService(destination, serviceName, destinationEnvironment, filter), nil
+}
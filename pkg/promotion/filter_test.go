@@ -0,0 +1,34 @@
+package promotion
+
+import (
+	"testing"
+
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/git/mock"
+)
+
+func TestFilterService(t *testing.T) {
+	devRepo, stagingRepo := mock.New("environments/dev", "master"), mock.New("environments/staging", "master")
+	devRepo.AddFiles(
+		"services/my-service/base/config/deployment.yaml",
+		"services/my-service/base/config/configmap-env.yaml",
+		"services/my-service/base/config/db.secret.yaml",
+		"services/my-service/base/config/README.md",
+	)
+	devRepo.AddFileContents("services/my-service/.promotionignore", []byte("# kept out of promotions\n*.secret.yaml\n"))
+	stagingRepo.AddFileContents("services/my-service/.promotionignore", []byte("configmap-env.yaml\n"))
+	sm := New("tmp", &git.Author{}, WithFilter([]string{"*.yaml"}, nil))
+
+	source, destination, err := sm.filterService("my-service", devRepo, stagingRepo, dev, "dev", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git.CopyService("my-service", source, destination, "dev", "staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	stagingRepo.AssertFileCopiedInBranch(t, "master", "environments/dev/services/my-service/base/config/deployment.yaml", "environments/staging/services/my-service/base/config/deployment.yaml")
+	for _, name := range []string{"configmap-env.yaml", "db.secret.yaml", "README.md"} {
+		stagingRepo.AssertFileNotCopiedInBranch(t, "master", "environments/dev/services/my-service/base/config/"+name, "environments/staging/services/my-service/base/config/"+name)
+	}
+}
@@ -2,13 +2,12 @@ package promotion
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/url"
 	"strings"
 
 	"github.com/rhd-gitops-example/services/pkg/git"
-	"github.com/rhd-gitops-example/services/pkg/local"
 
 	"github.com/google/uuid"
 	"github.com/jenkins-x/go-scm/scm"
@@ -19,10 +18,17 @@ import (
 //
 // It uses a Git cache to checkout the code to, and will copy the environment
 // configuration for the `fromURL` to the `toURL` in a named branch.
-func (s *ServiceManager) Promote(serviceName string, from, to EnvLocation, newBranchName, message string, keepCache bool) error {
-	var reposToDelete []git.Repo
-	if !keepCache {
-		defer clearCache(&reposToDelete)
+//
+// The git commands, and the request to create the pull request, are stopped if
+// the context is cancelled, the cache is still cleaned up.
+func (s *ServiceManager) Promote(ctx context.Context, serviceName string, from, to EnvLocation, newBranchName, message string, keepCache bool) error {
+	s = s.withLogFields("service", serviceName, "from", from.RepoPath, "to", to.RepoPath)
+	var checkouts []git.Repo
+	defer s.clearCache(&checkouts, keepCache)
+
+	strategy, err := s.lookupStrategy()
+	if err != nil {
+		return err
 	}
 
 	fromIsLocal, err := from.IsLocal()
@@ -32,79 +38,139 @@ func (s *ServiceManager) Promote(serviceName string, from, to EnvLocation, newBr
 
 	var source git.Source
 	if fromIsLocal {
-		source = s.localFactory(from.RepoPath, s.debug)
+		source = s.localFactory(ctx, from.RepoPath, s.logger)
 	} else {
-		source, err = s.checkoutSourceRepo(from.RepoPath, from.Branch)
+		repo, err := s.checkoutSourceRepo(ctx, from.RepoPath, from.Branch)
+		if repo != nil {
+			checkouts = append(checkouts, repo)
+		}
 		if err != nil {
-			return git.GitError("error checking out source repository from Git", from.RepoPath)
+			return git.WrapGitError(err, "error checking out source repository from Git", from.RepoPath)
+		}
+		if err := checkoutRef(repo, from); err != nil {
+			return err
 		}
-		reposToDelete = append(reposToDelete, source.(git.Repo))
+		source = repo
 	}
 	if newBranchName == "" {
 		newBranchName = generateBranchName(source)
 	}
+	s = s.withLogFields("branch", newBranchName)
 
-	destination, err := s.checkoutDestinationRepo(to.RepoPath, to.Branch, newBranchName)
+	destination, err := s.checkoutDestinationRepo(ctx, to.RepoPath, to.Branch, newBranchName)
+	if destination != nil {
+		checkouts = append(checkouts, destination)
+	}
 	if err != nil {
 		return err
 	}
-	reposToDelete = append(reposToDelete, destination)
 	destinationEnvironment, err := getEnvironmentFolder(destination, to.Folder)
 	if err != nil {
 		return err
 	}
 
-	var copied []string
-	if fromIsLocal {
-		copied, err = local.CopyConfig(serviceName, source, destination, destinationEnvironment)
-		if err != nil {
-			return fmt.Errorf("failed to set up local repository: %w", err)
-		}
-	} else {
+	var sourceEnvironment string
+	if !fromIsLocal {
 		repo, ok := source.(git.Repo)
 		if !ok {
 			// should not happen, but just in case
 			return fmt.Errorf("failed to convert source '%v' to Git Repo", source)
 		}
-		sourceEnvironment, err := getEnvironmentFolder(repo, from.Folder)
+		sourceEnvironment, err = getEnvironmentFolder(repo, from.Folder)
 		if err != nil {
 			return err
 		}
-
-		copied, err = git.CopyService(serviceName, source, destination, sourceEnvironment, destinationEnvironment)
-		if err != nil {
-			return fmt.Errorf("failed to copy service: %w", err)
+		if err := s.validateService(repo, serviceName, sourceEnvironment); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return git.Errorf(ErrValidation, "source repository failed validation: %w", err)
 		}
 	}
 
+	filteredSource, filteredDestination, err := s.filterService(serviceName, source, destination, from, sourceEnvironment, destinationEnvironment)
+	if err != nil {
+		return err
+	}
+	copied, err := strategy.Promote(serviceName, filteredSource, filteredDestination, sourceEnvironment, destinationEnvironment)
+	if err != nil {
+		return fmt.Errorf("failed to promote service: %w", err)
+	}
+	substitutions, err := git.SubstituteValues(serviceName, destination, destinationEnvironment, copied)
+	if err != nil {
+		return fmt.Errorf("failed to substitute environment values: %w", err)
+	}
+	for _, sub := range substitutions {
+		s.logger.Info("substituted environment value", "file", sub.File, "path", sub.Path, "old", sub.From, "new", sub.To)
+	}
+
 	if message == "" {
 		message = generateDefaultCommitMsg(source, serviceName, from)
 	}
+	message = withSubstitutions(message, substitutions)
+	if from.Ref != "" {
+		message = git.AppendTrailers(message, promotedRefTrailer(source, from))
+	}
+	return s.commitAndCreatePullRequest(ctx, destination, from, to, newBranchName, message, copied)
+}
+
+// commitAndCreatePullRequest validates the promoted files, and commits them to
+// the new branch in the destination, which is pushed, and a pull request
+// opened for it.
+func (s *ServiceManager) commitAndCreatePullRequest(ctx context.Context, destination git.Repo, from, to EnvLocation, newBranchName, message string, copied []string) error {
+	if err := git.ValidateFiles(destination, copied...).Err(); err != nil {
+		return git.Errorf(ErrValidation, "promoted configuration failed validation: %w", err)
+	}
+	if err := s.validateSchemas(destination, copied); err != nil {
+		return err
+	}
+
 	if err := destination.StageFiles(copied...); err != nil {
 		return fmt.Errorf("failed to stage files %s: %w", copied, err)
 	}
 	if err := destination.Commit(message, s.author); err != nil {
 		return fmt.Errorf("failed to commit: %w", err)
 	}
-	if err := destination.Push(newBranchName); err != nil {
+	if err := s.push(ctx, destination, newBranchName); err != nil {
 		return fmt.Errorf("failed to push to Git repository - check the access token is correct with sufficient permissions: %w", err)
 	}
 
-	ctx := context.Background()
-	pr, err := createPullRequest(ctx, from, to, newBranchName, message, s.clientFactory(s.author.Token, to.RepoPath, s.repoType, s.tlsVerify))
+	token, err := s.tokens.Token(ctx, to.RepoPath)
 	if err != nil {
-		message := fmt.Sprintf("failed to create a pull-request for branch %s, error: %s", newBranchName, err)
-		return git.GitError(message, to.RepoPath)
+		return git.WrapGitError(err, "failed to find the access token", to.RepoPath)
+	}
+	pr, err := s.createPullRequest(ctx, from, to, newBranchName, message, s.clientFactory(token, to.RepoPath, s.repoType, s.tlsVerify))
+	if err != nil {
+		return git.WrapGitError(err, fmt.Sprintf("failed to create a pull-request for branch %s", newBranchName), to.RepoPath)
+	}
+	s.logger.Info("created pull request", "number", pr.Number, "url", pr.Link)
+	return nil
+}
+
+// checkoutRef checks out the location's ref in the repository, if there is one.
+func checkoutRef(r git.Repo, location EnvLocation) error {
+	if location.Ref == "" {
+		return nil
+	}
+	if err := r.CheckoutRef(location.Ref, location.Branch); err != nil {
+		return fmt.Errorf("failed to checkout the requested ref: %w", err)
 	}
-	log.Printf("created PR %d", pr.Number)
 	return nil
 }
 
-func clearCache(repos *[]git.Repo) {
+// clearCache deletes the checkouts of the repositories from the cache, or if
+// the cache is kept, releases them so that they can be removed later.
+func (s *ServiceManager) clearCache(repos *[]git.Repo, keepCache bool) {
 	for _, repo := range *repos {
+		if keepCache {
+			if err := repo.Release(); err != nil {
+				s.logger.Warn("failed releasing files in cache", "error", err)
+			}
+			continue
+		}
 		err := repo.DeleteCache()
 		if err != nil {
-			log.Printf("failed deleting files from cache: %s", err)
+			s.logger.Warn("failed deleting files from cache", "error", err)
 		}
 	}
 }
@@ -126,6 +192,28 @@ func generateBranchName(source git.Source) string {
 	return strings.Replace(branchName, "\n", "", -1)
 }
 
+// withSubstitutions adds the environment values that were substituted in the
+// promoted files to the message, so that they're shown in the commit and the
+// pull request.
+func withSubstitutions(message string, substitutions []git.Substitution) string {
+	if len(substitutions) == 0 {
+		return message
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(message, "\n"))
+	b.WriteString("\n\nSubstituted environment values:")
+	for _, sub := range substitutions {
+		fmt.Fprintf(&b, "\n- %s %s: %s -> %s", sub.File, sub.Path, sub.From, sub.To)
+	}
+	return b.String()
+}
+
+// promotedRefTrailer returns the trailer that records the ref that was
+// promoted, and the commit that it resolved to.
+func promotedRefTrailer(source git.Source, from EnvLocation) string {
+	return fmt.Sprintf("Promoted-Ref: %s (%s)", from.Ref, source.(git.Repo).GetCommitID())
+}
+
 // generateDefaultCommitMsg constructs a default commit message based on the source information.
 func generateDefaultCommitMsg(source git.Source, serviceName string, from EnvLocation) string {
 	repo, ok := source.(git.Repo)
@@ -137,7 +225,9 @@ func generateDefaultCommitMsg(source git.Source, serviceName string, from EnvLoc
 	}
 }
 
-func createPullRequest(ctx context.Context, from, to EnvLocation, newBranchName, commitMsg string, client *scm.Client) (*scm.PullRequest, error) {
+// createPullRequest creates the pull request for the branch, retrying it with
+// the retry policy if the API fails with a server error, or is rate limited.
+func (s *ServiceManager) createPullRequest(ctx context.Context, from, to EnvLocation, newBranchName, commitMsg string, client *scm.Client) (*scm.PullRequest, error) {
 	prInput, err := makePullRequestInput(from, to, newBranchName, commitMsg)
 	if err != nil {
 		return nil, err
@@ -145,7 +235,23 @@ func createPullRequest(ctx context.Context, from, to EnvLocation, newBranchName,
 
 	u, _ := url.Parse(to.RepoPath)
 	pathToUse := strings.TrimPrefix(strings.TrimSuffix(u.Path, ".git"), "/")
-	pr, _, err := client.PullRequests.Create(ctx, pathToUse, prInput)
+	var pr *scm.PullRequest
+	var res *scm.Response
+	err = s.retry.Do(ctx, func(err error) bool {
+		if !isTransientResponse(res, err) {
+			return false
+		}
+		s.logger.Warn("retrying after a transient failure", "operation", "create pull request", "error", err)
+		return true
+	}, func() error {
+		pr, res, err = client.PullRequests.Create(ctx, pathToUse, prInput)
+		return err
+	})
+	if err != nil && res != nil {
+		if kind := git.ErrorForStatus(res.Status); kind != nil {
+			return nil, git.Errorf(kind, "%w", err)
+		}
+	}
 	return pr, err
 }
 
@@ -156,19 +262,19 @@ func getEnvironmentFolder(r git.Repo, folder string) (string, error) {
 	if folder == "" {
 		dir, err := r.GetUniqueEnvironmentFolder()
 		if err != nil {
-			return "", fmt.Errorf("could not determine unique environment name for source repository - check that only one directory exists under it and you can write to your cache folder")
+			return "", git.Errorf(ErrNotFound, "could not determine unique environment name for source repository - check that only one directory exists under it and you can write to your cache folder")
 		}
 		return dir, nil
 	}
 
-	dirs, err := r.DirectoriesUnderPath("environments")
+	envs, err := r.Layout().Environments(r)
 	if err != nil {
 		return "", err
 	}
-	for _, dir := range dirs {
-		if dir.Name() == folder {
-			return dir.Name(), nil
+	for _, env := range envs {
+		if env == folder {
+			return env, nil
 		}
 	}
-	return "", fmt.Errorf("did not find environment folder matching '%v', only found '%v'", folder, dirs)
+	return "", git.Errorf(ErrNotFound, "did not find environment folder matching '%v', only found '%v'", folder, envs)
 }
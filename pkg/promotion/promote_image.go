@@ -0,0 +1,71 @@
+package promotion
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rhd-gitops-example/services/pkg/git"
+)
+
+// PromoteImage updates the images used by a service in the destination to the
+// image reference, and opens a pull request for the change.
+//
+// No source repository is needed, the container images and kustomize images
+// entries in the service's configuration that are for the same image are
+// changed to the new reference.
+func (s *ServiceManager) PromoteImage(ctx context.Context, serviceName, image string, to EnvLocation, newBranchName, message string, keepCache bool) error {
+	s = s.withLogFields("service", serviceName, "image", image, "to", to.RepoPath)
+	var checkouts []git.Repo
+	defer s.clearCache(&checkouts, keepCache)
+
+	name, tag, digest := git.ParseImage(image)
+	if tag == "" && digest == "" {
+		return fmt.Errorf("image %s must have a tag or a digest", image)
+	}
+	if newBranchName == "" {
+		newBranchName = generateImageBranchName(name, tag, digest)
+	}
+	s = s.withLogFields("branch", newBranchName)
+
+	destination, err := s.checkoutDestinationRepo(ctx, to.RepoPath, to.Branch, newBranchName)
+	if destination != nil {
+		checkouts = append(checkouts, destination)
+	}
+	if err != nil {
+		return err
+	}
+	destinationEnvironment, err := getEnvironmentFolder(destination, to.Folder)
+	if err != nil {
+		return err
+	}
+
+	updated, err := git.UpdateImage(serviceName, destination, destinationEnvironment, image)
+	if err != nil {
+		return fmt.Errorf("failed to update image: %w", err)
+	}
+	if len(updated) == 0 {
+		return git.Errorf(ErrNoChanges, "no images for %s that need updating were found for service %s in environment %s", name, serviceName, destinationEnvironment)
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Promote service %s to image %s", serviceName, image)
+	}
+	return s.commitAndCreatePullRequest(ctx, destination, EnvLocation{RepoPath: image}, to, newBranchName, message, updated)
+}
+
+// generateImageBranchName constructs a branch name based on the image and a
+// random UUID.
+func generateImageBranchName(name, tag, digest string) string {
+	version := tag
+	if digest != "" {
+		version = digest[strings.Index(digest, ":")+1:]
+		if len(version) > 7 {
+			version = version[:7]
+		}
+	}
+	uniqueString := uuid.New().String()
+	return path.Base(name) + "-" + version + "-" + uniqueString[0:5]
+}
@@ -0,0 +1,90 @@
+package promotion
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/git/mock"
+	"github.com/rhd-gitops-example/services/pkg/logging"
+	"github.com/rhd-gitops-example/services/test"
+)
+
+const imageDeployment = `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+        - name: my-service
+          image: quay.io/example/my-service:v1
+`
+
+func TestPromoteImage(t *testing.T) {
+	dstBranch := "test-branch"
+	image := "quay.io/example/my-service@sha256:abcdef"
+	author := &git.Author{Name: "Testing User", Email: "testing@example.com"}
+	stagingRepo := mock.New("environments/staging", "master")
+	sm := New("tmp", author)
+	sm.clientFactory = func(s, ty, r string, v bool) *scm.Client {
+		client, _ := fakescm.NewDefault()
+		return client
+	}
+	sm.repoFactory = func(_ context.Context, url, _ string, _ bool, _ logging.Logger) (git.Repo, error) {
+		return git.Repo(stagingRepo), nil
+	}
+	stagingRepo.AddFileContents("services/my-service/base/config/deployment.yaml", []byte(imageDeployment))
+
+	err := sm.PromoteImage(context.Background(), "my-service", image, staging, dstBranch, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stagingRepo.AssertBranchCreated(t, "master", dstBranch)
+	stagingRepo.AssertCommit(t, dstBranch, "Promote service my-service to image quay.io/example/my-service@sha256:abcdef", author)
+	stagingRepo.AssertPush(t, dstBranch)
+	stagingRepo.AssertDeletedFromCache(t)
+}
+
+func TestPromoteImageWithNoMatchingImages(t *testing.T) {
+	author := &git.Author{Name: "Testing User", Email: "testing@example.com"}
+	stagingRepo := mock.New("environments/staging", "master")
+	sm := New("tmp", author)
+	sm.repoFactory = func(_ context.Context, url, _ string, _ bool, _ logging.Logger) (git.Repo, error) {
+		return git.Repo(stagingRepo), nil
+	}
+	stagingRepo.AddFileContents("services/my-service/base/config/deployment.yaml", []byte(imageDeployment))
+
+	err := sm.PromoteImage(context.Background(), "my-service", "quay.io/example/other:v2", staging, "test-branch", "", false)
+	test.AssertErrorMatch(t, "no images for quay.io/example/other that need updating were found for service my-service in environment staging", err)
+	stagingRepo.AssertNoCommits(t)
+}
+
+func TestPromoteImageWithNoTagOrDigest(t *testing.T) {
+	sm := New("tmp", &git.Author{})
+
+	err := sm.PromoteImage(context.Background(), "my-service", "quay.io/example/my-service", staging, "test-branch", "", false)
+	test.AssertErrorMatch(t, "image quay.io/example/my-service must have a tag or a digest", err)
+}
+
+func TestGenerateImageBranchName(t *testing.T) {
+	nameTests := []struct {
+		name   string
+		tag    string
+		digest string
+		want   string
+	}{
+		{"quay.io/example/my-service", "v1", "", "^my-service-v1-[0-9a-f]{5}$"},
+		{"quay.io/example/my-service", "v1", "sha256:abcdef123456", "^my-service-abcdef1-[0-9a-f]{5}$"},
+	}
+
+	for _, tt := range nameTests {
+		branch := generateImageBranchName(tt.name, tt.tag, tt.digest)
+		if !regexp.MustCompile(tt.want).MatchString(branch) {
+			t.Errorf("generateImageBranchName() got %s, want match for %s", branch, tt.want)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
 	"github.com/rhd-gitops-example/services/pkg/git"
 	"github.com/rhd-gitops-example/services/pkg/git/mock"
+	"github.com/rhd-gitops-example/services/pkg/logging"
 )
 
 const (
@@ -24,13 +25,13 @@ const (
 )
 
 var (
-	dev_repo           = EnvLocation{exampleDevRepo, "master", ""}
-	staging_repo       = EnvLocation{exampleStagingRepo, "master", ""}
-	team_a_branch      = EnvLocation{exampleAlternativeRepo, "team-a", ""}
-	team_b_branch      = EnvLocation{exampleAlternativeRepo, "team-b", ""}
-	dev_env            = EnvLocation{exampleAlternativeRepo, "main", "dev"}
-	staging_env        = EnvLocation{exampleAlternativeRepo, "main", "staging"}
-	teams_branch_a_env = EnvLocation{exampleAlternativeRepo, "team-envs", "team-a"}
+	dev_repo           = EnvLocation{exampleDevRepo, "master", "", ""}
+	staging_repo       = EnvLocation{exampleStagingRepo, "master", "", ""}
+	team_a_branch      = EnvLocation{exampleAlternativeRepo, "team-a", "", ""}
+	team_b_branch      = EnvLocation{exampleAlternativeRepo, "team-b", "", ""}
+	dev_env            = EnvLocation{exampleAlternativeRepo, "main", "dev", ""}
+	staging_env        = EnvLocation{exampleAlternativeRepo, "main", "staging", ""}
+	teams_branch_a_env = EnvLocation{exampleAlternativeRepo, "team-envs", "team-a", ""}
 )
 
 func TestRepoPromotionPath(t *testing.T) {
@@ -60,18 +61,18 @@ func promotionPath(t *testing.T, from, to EnvLocation, fromEnv string) {
 	src, dest, clean := mustGetCaches(t, from, to)
 	defer clean()
 
-	author := &git.Author{Name: "Testing User", Email: "testing@example.com", Token: "test-token"}
-	srcURL := mustAddCredentials(t, from.RepoPath, author)
-	destURL := mustAddCredentials(t, to.RepoPath, author)
+	author := &git.Author{Name: "Testing User", Email: "testing@example.com"}
+	srcURL := from.RepoPath
+	destURL := to.RepoPath
 	fakeSCMClient, _ := fakescm.NewDefault()
 
 	sm := New("tmp", author)
 	sm.clientFactory = func(s, ty, r string, v bool) *scm.Client {
 		return fakeSCMClient
 	}
-	sm.repoFactory = func(url, localPath string, v bool, _ bool) (git.Repo, error) {
-		if url == srcURL && strings.HasSuffix(localPath, neturl.QueryEscape(from.Branch)) {
-			return src, nil
+	sm.repoFactory = func(_ context.Context, url, localPath string, v bool, _ logging.Logger) (git.Repo, error) {
+		if url == srcURL && strings.Contains(localPath, neturl.QueryEscape(from.Branch)+"-") {
+			return preparedRepo{src}, nil
 		}
 		if url == destURL { // This needs to handle newly created branches as well as the original destination
 			return dest, nil
@@ -81,7 +82,7 @@ func promotionPath(t *testing.T, from, to EnvLocation, fromEnv string) {
 
 	testFileName := mustAddTestFile(t, src, fromEnv, "service-a", author)
 
-	err := sm.Promote("service-a", from, to, "", "", true)
+	err := sm.Promote(context.Background(), "service-a", from, to, "", "", true)
 	if err != nil {
 		t.Fatal("Promote failed unexpectedly: ", err)
 	}
@@ -90,6 +91,16 @@ func promotionPath(t *testing.T, from, to EnvLocation, fromEnv string) {
 	assertPullRequestCorrect(t, fakeSCMClient, to.Branch)
 }
 
+// preparedRepo is a repository with a local commit that's not been pushed, the
+// commit is kept when the promotion checks out the branch.
+type preparedRepo struct {
+	*git.Repository
+}
+
+func (preparedRepo) Checkout(branch string) error {
+	return nil
+}
+
 func mustGetCaches(t *testing.T, from, to EnvLocation) (src, dest *git.Repository, clean func()) {
 	t.Helper()
 	src, cleanSrc, err := getNewCacheOf(from)
@@ -125,7 +136,7 @@ func getNewCacheOf(l EnvLocation) (r *git.Repository, clean func() error, err er
 		return os.RemoveAll(dir)
 	}
 
-	r, err = git.NewRepository(l.RepoPath, dir, true, true)
+	r, err = git.NewRepository(l.RepoPath, dir, true, nil)
 	if err != nil {
 		return r, clean, err
 	}
@@ -1,15 +1,20 @@
 package promotion
 
 import (
+	"strings"
+
 	"github.com/jenkins-x/go-scm/scm"
 )
 
 // TODO: OptionFunc for Title?
 // TODO: For the Head, should this try and determine whether or not this is a
 // fork ("user" of both repoURLs) and if so, simplify the Head?
+//
+// The title is the first line of the body, e.g. the subject of the commit
+// message.
 func makePullRequestInput(from, to EnvLocation, branchName, prBody string) (*scm.PullRequestInput, error) {
 	return &scm.PullRequestInput{
-		Title: prBody,
+		Title: strings.SplitN(prBody, "\n", 2)[0],
 		Head:  branchName,
 		Base:  to.Branch,
 		Body:  prBody,
@@ -33,3 +33,15 @@ func TestMakePullRequestInput(t *testing.T) {
 		t.Fatalf("pull request input is different from expected: %s", diff)
 	}
 }
+
+func TestMakePullRequestInputWithMultipleLines(t *testing.T) {
+	body := "Promote service-a\n\nPromoted-Ref: v1.2.0 (a1b2c3d)"
+	pr, err := makePullRequestInput(EnvLocation{}, EnvLocation{Branch: "master"}, "my-test-branch", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pr.Title != "Promote service-a" || pr.Body != body {
+		t.Fatalf("got title %q and body %q", pr.Title, pr.Body)
+	}
+}
@@ -0,0 +1,74 @@
+package promotion
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+
+	"github.com/rhd-gitops-example/services/pkg/git"
+)
+
+// retryGit calls the git operation, e.g. a clone, retrying it with the retry
+// policy if it fails in a way that's likely to succeed if it's retried.
+func (s *ServiceManager) retryGit(ctx context.Context, operation string, op func() error) error {
+	return s.retry.Do(ctx, func(err error) bool {
+		if !git.IsTransient(err) {
+			return false
+		}
+		s.logger.Warn("retrying after a transient failure", "operation", operation, "error", err)
+		return true
+	}, op)
+}
+
+// push pushes the branch, retrying transient failures, if the push is rejected
+// because the remote branch has changed, the promotion commit is rebased onto
+// the remote branch and the push retried.
+func (s *ServiceManager) push(ctx context.Context, repo git.Repo, branch string) error {
+	rebase, rejected := false, false
+	return s.retry.Do(ctx, func(err error) bool {
+		if rejected {
+			s.logger.Warn("rebasing after the push was rejected", "error", err)
+			return true
+		}
+		if !git.IsTransient(err) {
+			return false
+		}
+		s.logger.Warn("retrying after a transient failure", "operation", "push", "error", err)
+		return true
+	}, func() error {
+		rejected = false
+		if rebase {
+			if err := repo.Rebase(branch); err != nil {
+				return err
+			}
+			rebase = false
+		}
+		err := repo.Push(branch)
+		rejected = errors.Is(err, git.ErrConflict)
+		rebase = rejected
+		return err
+	})
+}
+
+// isTransientResponse returns true if a request to a Git hosting service's API
+// failed in a way that's likely to succeed if it's retried, e.g. a server error,
+// or the request was rate limited.
+func isTransientResponse(res *scm.Response, err error) bool {
+	if res == nil {
+		var netErr net.Error
+		return errors.As(err, &netErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch {
+	case res.Status >= http.StatusInternalServerError, res.Status == http.StatusTooManyRequests:
+		return true
+	case res.Status == http.StatusForbidden:
+		// GitHub's secondary rate limits are a 403, with a Retry-After header.
+		return res.Header.Get("Retry-After") != "" || res.Header.Get("X-RateLimit-Remaining") == "0" ||
+			strings.Contains(strings.ToLower(err.Error()), "rate limit")
+	}
+	return false
+}
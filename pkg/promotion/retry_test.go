@@ -0,0 +1,163 @@
+package promotion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	"github.com/jenkins-x/go-scm/scm/driver/github"
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/git/mock"
+	"github.com/rhd-gitops-example/services/pkg/logging"
+	"github.com/rhd-gitops-example/services/pkg/retry"
+)
+
+var testRetryPolicy = retry.Policy{Attempts: 3}
+
+func TestPromoteRetriesTransientFailures(t *testing.T) {
+	devRepo, stagingRepo := mock.New("environments/dev", "master"), mock.New("environments/staging", "master")
+	devRepo.CloneErrs = []error{transientError("clone")}
+	stagingRepo.PushErrs = []error{transientError("push"), transientError("push")}
+	sm := newRetryTestServiceManager(devRepo, stagingRepo)
+
+	err := sm.Promote(context.Background(), "my-service", dev, staging, "test-branch", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stagingRepo.AssertPush(t, "test-branch")
+	stagingRepo.AssertNotRebased(t)
+}
+
+func TestPromoteStopsRetryingAfterAttempts(t *testing.T) {
+	devRepo, stagingRepo := mock.New("environments/dev", "master"), mock.New("environments/staging", "master")
+	stagingRepo.PushErrs = []error{transientError("push"), transientError("push"), transientError("push")}
+	sm := newRetryTestServiceManager(devRepo, stagingRepo)
+
+	err := sm.Promote(context.Background(), "my-service", dev, staging, "test-branch", "", false)
+
+	if !git.IsTransient(err) {
+		t.Fatalf("got %v, want the transient push failure", err)
+	}
+}
+
+func TestPromoteRebasesRejectedPush(t *testing.T) {
+	devRepo, stagingRepo := mock.New("environments/dev", "master"), mock.New("environments/staging", "master")
+	stagingRepo.PushErrs = []error{rejectedError()}
+	sm := newRetryTestServiceManager(devRepo, stagingRepo)
+
+	err := sm.Promote(context.Background(), "my-service", dev, staging, "test-branch", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stagingRepo.AssertRebased(t, "test-branch")
+	stagingRepo.AssertPush(t, "test-branch")
+}
+
+func TestPromoteDoesNotRetryConflictingRebase(t *testing.T) {
+	devRepo, stagingRepo := mock.New("environments/dev", "master"), mock.New("environments/staging", "master")
+	stagingRepo.PushErrs = []error{rejectedError(), rejectedError()}
+	stagingRepo.RebaseErr = git.Errorf(git.ErrConflict, "failed to rebase onto branch test-branch")
+	sm := newRetryTestServiceManager(devRepo, stagingRepo)
+
+	err := sm.Promote(context.Background(), "my-service", dev, staging, "test-branch", "", false)
+
+	if !errors.Is(err, git.ErrConflict) {
+		t.Fatalf("got %v, want a conflict", err)
+	}
+	if len(stagingRepo.PushErrs) != 1 {
+		t.Fatalf("pushed %d times after the rebase failed", 1-len(stagingRepo.PushErrs))
+	}
+}
+
+func TestCreatePullRequestRetries(t *testing.T) {
+	retryTests := []struct {
+		name     string
+		status   int
+		header   http.Header
+		body     string
+		requests int
+		wantErr  bool
+	}{
+		{"server error", http.StatusBadGateway, nil, `{"message": "Server Error"}`, 2, false},
+		{"rate limited", http.StatusTooManyRequests, nil, `{"message": "Too Many Requests"}`, 2, false},
+		{"secondary rate limit", http.StatusForbidden, http.Header{"Retry-After": {"1"}}, `{"message": "You have exceeded a secondary rate limit"}`, 2, false},
+		{"forbidden", http.StatusForbidden, nil, `{"message": "Resource not accessible by integration"}`, 1, true},
+		{"invalid", http.StatusUnprocessableEntity, nil, `{"message": "Validation Failed"}`, 1, true},
+	}
+	for _, tt := range retryTests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.Method != http.MethodPost || r.URL.Path != "/repos/testing/staging-env/pulls" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				if requests == 1 {
+					for k, v := range tt.header {
+						w.Header()[k] = v
+					}
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, tt.body)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"number": 1, "html_url": "https://example.com/testing/staging-env/pull/1"}`)
+			}))
+			defer ts.Close()
+			client, err := github.New(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sm := New("tmp", nil, WithRetry(testRetryPolicy), WithLogger(logging.Discard()))
+
+			pr, err := sm.createPullRequest(context.Background(), dev, staging, "test-branch", "test message", client)
+
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && pr.Number != 1 {
+				t.Fatalf("got pull request %d, want 1", pr.Number)
+			}
+			if requests != tt.requests {
+				t.Fatalf("got %d requests, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func newRetryTestServiceManager(devRepo, stagingRepo *mock.Repository) *ServiceManager {
+	repos := map[string]*mock.Repository{
+		dev.RepoPath:     devRepo,
+		staging.RepoPath: stagingRepo,
+	}
+	devRepo.AddFiles("services/my-service/base/config/myfile.yaml")
+	stagingRepo.AddFiles("")
+	sm := New("tmp", &git.Author{Name: "Testing User", Email: "testing@example.com"}, WithRetry(testRetryPolicy), WithLogger(logging.Discard()))
+	sm.clientFactory = func(s, ty, r string, v bool) *scm.Client {
+		client, _ := fakescm.NewDefault()
+		return client
+	}
+	sm.repoFactory = func(_ context.Context, url, _ string, _ bool, _ logging.Logger) (git.Repo, error) {
+		return git.Repo(repos[url]), nil
+	}
+	return sm
+}
+
+// transientError returns the error from a git command that failed because the
+// server was unavailable.
+func transientError(command string) error {
+	return &git.CommandError{Command: command, Output: "fatal: the remote end hung up unexpectedly", Err: errors.New("exit status 128")}
+}
+
+// rejectedError returns the error from a push that was rejected because the
+// remote branch had changed.
+func rejectedError() error {
+	return &git.CommandError{Command: "push", Output: " ! [rejected]        test-branch -> test-branch (fetch first)", Kind: git.ErrConflict, Err: errors.New("exit status 1")}
+}
@@ -1,17 +1,21 @@
 package promotion
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"log"
 	"net/url"
+	"os"
 	"path"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jenkins-x/go-scm/scm"
 
 	"github.com/rhd-gitops-example/services/pkg/git"
 	"github.com/rhd-gitops-example/services/pkg/local"
+	"github.com/rhd-gitops-example/services/pkg/logging"
+	"github.com/rhd-gitops-example/services/pkg/retry"
 )
 
 type ServiceManager struct {
@@ -22,46 +26,84 @@ type ServiceManager struct {
 	localFactory  localFactory
 	tlsVerify     bool
 	repoType      string
-	debug         bool
+	logger        logging.Logger
+	lockTimeout   time.Duration
+	tokens        *git.Tokens
+	retry         retry.Policy
+
+	validationMode ValidationMode
+	schemaDir      string
+	strategy       string
+	helmValues     []string
+	include        []string
+	exclude        []string
+	localPaths     []local.Path
+	renderer       *local.Renderer
 }
 
 type scmClientFactory func(token, toURL, repoType string, tlsVerify bool) *scm.Client
-type repoFactory func(url, localPath string, tlsVerify, debug bool) (git.Repo, error)
-type localFactory func(localPath string, debug bool) git.Source
+type repoFactory func(ctx context.Context, url, localPath string, tlsVerify bool, logger logging.Logger) (git.Repo, error)
+type localFactory func(ctx context.Context, localPath string, logger logging.Logger) git.Source
 type serviceOpt func(*ServiceManager)
 
 // New creates and returns a new ServiceManager.
 //
-// The cacheDir used to checkout the source and destination repos.
-// The token is used to create a Git token
+// The cacheDir used to checkout the source and destination repos, the repos
+// are mirrored in the cache, and checked out to worktrees of the mirrors.
+// The tokens used to authenticate with the repositories are configured with
+// WithTokens, and the logger with WithLogger, by default messages are logged to
+// stderr at the info level. Transient failures of the git commands and the API
+// requests are retried with retry.DefaultPolicy, unless configured with
+// WithRetry.
 func New(cacheDir string, author *git.Author, opts ...serviceOpt) *ServiceManager {
 	sm := &ServiceManager{
 		cacheDir:      cacheDir,
 		author:        author,
 		clientFactory: git.CreateClient,
-		repoFactory: func(url, localPath string, tlsVerify, debug bool) (git.Repo, error) {
-			r, err := git.NewRepository(url, localPath, tlsVerify, debug)
-			return git.Repo(r), err
-		},
-		localFactory: func(localPath string, debug bool) git.Source {
-			l := &local.Local{LocalPath: localPath, Debug: debug, Logger: log.Printf}
-			return git.Source(l)
-		},
+		retry:         retry.DefaultPolicy,
+	}
+	sm.repoFactory = func(ctx context.Context, url, localPath string, tlsVerify bool, logger logging.Logger) (git.Repo, error) {
+		cache := &git.Cache{Dir: cacheDir, LockTimeout: sm.lockTimeout, Tokens: sm.tokens}
+		r, err := cache.NewRepository(url, localPath, tlsVerify, logger)
+		if err != nil {
+			return nil, err
+		}
+		r.SetContext(ctx)
+		return r, nil
+	}
+	sm.localFactory = func(ctx context.Context, localPath string, logger logging.Logger) git.Source {
+		l := &local.Local{LocalPath: localPath, Paths: sm.localPaths, Renderer: sm.renderer, Logger: logger}
+		l.SetContext(ctx)
+		return git.Source(l)
 	}
 	for _, o := range opts {
 		o(sm)
 	}
+	if sm.tokens == nil {
+		sm.tokens = &git.Tokens{}
+	}
+	if sm.logger == nil {
+		sm.logger = logging.New(os.Stderr, logging.FormatText, logging.LevelInfo, sm.tokens.Secrets)
+	}
 	return sm
 }
 
-// WithDebug is a service option that configures the ServiceManager for
-// additional debugging.
-func WithDebug(f bool) serviceOpt {
+// WithLogger is a service option that configures the logger for the
+// ServiceManager, and the repositories it checks out.
+func WithLogger(l logging.Logger) serviceOpt {
 	return func(sm *ServiceManager) {
-		sm.debug = f
+		sm.logger = l
 	}
 }
 
+// withLogFields returns a copy of the ServiceManager that logs the fields with
+// every message, e.g. the service that's being promoted.
+func (s *ServiceManager) withLogFields(keysAndValues ...interface{}) *ServiceManager {
+	c := *s
+	c.logger = s.logger.With(keysAndValues...)
+	return &c
+}
+
 // WithTlsVerify is a service option that configures the ServiceManager for
 // TLS verify option.
 func WithInsecureSkipVerify(f bool) serviceOpt {
@@ -78,80 +120,162 @@ func WithRepoType(f string) serviceOpt {
 	}
 }
 
-func (s *ServiceManager) checkoutSourceRepo(repoURL, branch string) (git.Repo, error) {
-	repo, err := s.cloneRepo(repoURL, branch)
+// WithLockTimeout is a service option that configures how long to wait for
+// other promotions sharing the cache to release the lock on a repository.
+func WithLockTimeout(d time.Duration) serviceOpt {
+	return func(sm *ServiceManager) {
+		sm.lockTimeout = d
+	}
+}
+
+// WithRetry is a service option that configures how the clones, fetches and
+// pushes of the repositories, and the requests to create pull requests, are
+// retried when they fail in a way that's likely to succeed if retried.
+func WithRetry(p retry.Policy) serviceOpt {
+	return func(sm *ServiceManager) {
+		sm.retry = p
+	}
+}
+
+// WithTokens is a service option that configures the tokens used to
+// authenticate with the source and destination repositories, which can be on
+// different hosts.
+func WithTokens(t *git.Tokens) serviceOpt {
+	return func(sm *ServiceManager) {
+		sm.tokens = t
+	}
+}
+
+// WithStrategy is a service option that configures the ServiceManager to
+// promote services using the named strategy, see RegisterStrategy.
+func WithStrategy(name string) serviceOpt {
+	return func(sm *ServiceManager) {
+		sm.strategy = name
+	}
+}
+
+// WithHelmValues is a service option that configures the keys in the charts'
+// values.yaml files that are promoted by the helm strategy. If no keys are
+// given, the strategy registered as "helm" is used, by default this promotes
+// git.DefaultHelmValues.
+func WithHelmValues(keys []string) serviceOpt {
+	return func(sm *ServiceManager) {
+		sm.helmValues = keys
+	}
+}
+
+// WithFilter is a service option that configures the ServiceManager to only
+// promote the files that match the include patterns, if any, and don't match
+// the exclude patterns, see git.Filter.
+func WithFilter(include, exclude []string) serviceOpt {
+	return func(sm *ServiceManager) {
+		sm.include = include
+		sm.exclude = exclude
+	}
+}
+
+// WithLocalPaths is a service option that configures the folders that are
+// promoted from a local service, by default this is the config folder.
+func WithLocalPaths(paths []local.Path) serviceOpt {
+	return func(sm *ServiceManager) {
+		sm.localPaths = paths
+	}
+}
+
+// WithRenderer is a service option that configures the ServiceManager to
+// render the templated files from a local service with the Renderer.
+func WithRenderer(r *local.Renderer) serviceOpt {
+	return func(sm *ServiceManager) {
+		sm.renderer = r
+	}
+}
+
+// WithSchemaValidation is a service option that configures the ServiceManager
+// to validate promoted files against the bundled Kubernetes schemas, and the
+// CustomResourceDefinitions in schemaDir if it's not empty.
+func WithSchemaValidation(mode ValidationMode, schemaDir string) serviceOpt {
+	return func(sm *ServiceManager) {
+		sm.validationMode = mode
+		sm.schemaDir = schemaDir
+	}
+}
+
+// checkoutSourceRepo clones the specified repo to the cache, and checks out the
+// branch.
+//
+// The repository is returned with the error if it was added to the cache before
+// the checkout failed, so that it can be deleted from the cache.
+func (s *ServiceManager) checkoutSourceRepo(ctx context.Context, repoURL, branch string) (git.Repo, error) {
+	repo, err := s.cloneRepo(ctx, sourceCache, repoURL, branch)
 	if err != nil {
 		if git.IsGitError(err) {
-			return nil, git.GitError("failed to clone source repository", repoURL)
+			return repo, git.WrapGitError(err, "failed to clone source repository", repoURL)
 		}
-		return nil, err
+		return repo, err
 	}
-	err = repo.Checkout(branch)
+	err = s.retryGit(ctx, "checkout", func() error {
+		return repo.Checkout(branch)
+	})
 	if err != nil {
-		return nil, git.GitError(fmt.Sprintf("failed to checkout branch %s, error: %s", branch, err.Error()), repoURL)
+		return repo, git.WrapGitError(err, fmt.Sprintf("failed to checkout branch %s", branch), repoURL)
 	}
 	return repo, nil
 }
 
 // checkoutDestinationRepo clones the specified repo to the cache, and creates a new
 // branch (the "tip" branch) which forks off of the "base" branch.
-func (s *ServiceManager) checkoutDestinationRepo(repoURL, baseBranch, tipBranch string) (git.Repo, error) {
-	repo, err := s.cloneRepo(repoURL, tipBranch)
+//
+// The repository is returned with the error if it was added to the cache before
+// the checkout failed, so that it can be deleted from the cache.
+func (s *ServiceManager) checkoutDestinationRepo(ctx context.Context, repoURL, baseBranch, tipBranch string) (git.Repo, error) {
+	repo, err := s.cloneRepo(ctx, destinationCache, repoURL, baseBranch)
 	if err != nil {
-		return nil, git.GitError(fmt.Sprintf("failed to clone destination repository, error: %s", err.Error()), repoURL)
+		return repo, git.WrapGitError(err, "failed to clone destination repository", repoURL)
 	}
 	// need to checkout the base branch first, in case it is different than the default branch of the repository.
-	err = repo.Checkout(baseBranch)
+	err = s.retryGit(ctx, "checkout", func() error {
+		return repo.Checkout(baseBranch)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to checkout existing branch %s, error: %w", baseBranch, err)
+		return repo, fmt.Errorf("failed to checkout existing branch %s, error: %w", baseBranch, err)
 	}
 	err = repo.CheckoutAndCreate(tipBranch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new branch %s, error: %w", tipBranch, err)
-	}
-	if repo == nil {
-		// Should never happen, but if it does...
-		return nil, fmt.Errorf("destination repository was not initialised despite being no errors")
+		return repo, fmt.Errorf("failed to create new branch %s, error: %w", tipBranch, err)
 	}
 	return repo, nil
 }
 
-// cloneRepo clones the default branch of the repository into the cache.
-// NOTE: the path the repo is cloned to includes the specified branch, but the
-// actual contents are from the default branch.
-func (s *ServiceManager) cloneRepo(repoURL, branch string) (git.Repo, error) {
-	// This ensures that the URL has credentials for the author.
-	repoURL, err := addCredentialsIfNecessary(repoURL, s.author)
+// The source and destination of a promotion are cached separately, as they can
+// be different branches of the same repository.
+const (
+	sourceCache      = "source"
+	destinationCache = "destination"
+)
+
+// cloneRepo clones the repository into the cache, or fetches it if it's already
+// cached, the branch that's checked out is not changed.
+//
+// Each checkout of the repository is in a separate path, so that the working
+// tree can be reset to the branch without disturbing other checkouts, including
+// those of other promotions sharing the cache.
+//
+// If the clone fails, the repository is returned with the error, so that
+// anything that was added to the cache can be deleted.
+func (s *ServiceManager) cloneRepo(ctx context.Context, cache, repoURL, branch string) (git.Repo, error) {
+	// The path doesn't include any credentials in the URL.
+	cleanedURL, err := git.CleanURL(repoURL)
 	if err != nil {
 		return nil, err
 	}
-	repo, err := s.repoFactory(repoURL, path.Join(s.cacheDir, encode(repoURL, branch)), s.tlsVerify, s.debug)
+	localPath := path.Join(s.cacheDir, cache, encode(cleanedURL, branch)+"-"+uuid.New().String()[:8])
+	repo, err := s.repoFactory(ctx, repoURL, localPath, s.tlsVerify, s.logger)
 	if err != nil {
-		message := fmt.Sprintf("failed to clone repository, error is: %s", err.Error())
-		return nil, git.GitError(message, repoURL)
+		return nil, git.WrapGitError(err, "failed to clone repository", repoURL)
 	}
-	err = repo.Clone()
-	if err != nil {
-		return nil, err
-	}
-	return repo, nil
+	return repo, s.retryGit(ctx, "clone", repo.Clone)
 }
 
 func encode(gitURL, branch string) string {
 	return url.QueryEscape(gitURL) + "-" + url.QueryEscape(branch)
 }
-
-func addCredentialsIfNecessary(s string, a *git.Author) (string, error) {
-	parsed, err := url.Parse(s)
-	// If this does error (e.g. if there's a leading ":" character") one would see
-	// parse ":thetoken@github.com": missing protocol scheme
-	// thus surfacing the token. So intentionally display a generic parse problem
-	if err != nil {
-		return "", errors.New("failed to parse git repository url")
-	}
-	if parsed.Scheme != "https" || parsed.User != nil {
-		return s, nil
-	}
-	parsed.User = url.UserPassword("promotion", a.Token)
-	return parsed.String(), nil
-}
@@ -0,0 +1,138 @@
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/local"
+)
+
+// Strategy is implemented by values that can promote the configuration for a
+// service from a source to a destination.
+//
+// When promoting from a local filesystem directory, the source is not a
+// git.Repo and the sourceEnvironment is empty.
+//
+// Returns the list of files in the destination that were changed, these are
+// staged and committed by Promote.
+type Strategy interface {
+	Promote(serviceName string, source git.Source, destination git.Repo, sourceEnvironment, destinationEnvironment string) ([]string, error)
+}
+
+// StrategyFunc is an adapter to allow the use of ordinary functions as
+// promotion strategies.
+type StrategyFunc func(serviceName string, source git.Source, destination git.Repo, sourceEnvironment, destinationEnvironment string) ([]string, error)
+
+// Promote calls f(serviceName, source, destination, sourceEnvironment, destinationEnvironment).
+func (f StrategyFunc) Promote(serviceName string, source git.Source, destination git.Repo, sourceEnvironment, destinationEnvironment string) ([]string, error) {
+	return f(serviceName, source, destination, sourceEnvironment, destinationEnvironment)
+}
+
+// DefaultStrategy is the name of the strategy used when none is configured,
+// it copies all the files for the service.
+const DefaultStrategy = "copy"
+
+// helmStrategy is the name of the strategy that promotes Helm charts, the keys
+// it promotes are configured for each ServiceManager with WithHelmValues.
+const helmStrategy = "helm"
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]Strategy{
+		"copy":       StrategyFunc(copyStrategy),
+		"mirror":     StrategyFunc(mirrorStrategy),
+		"image-only": StrategyFunc(imageOnlyStrategy),
+		"helm":       NewHelmStrategy(git.DefaultHelmValues...),
+	}
+)
+
+// RegisterStrategy makes a promotion strategy available by name, replacing
+// any strategy already registered with that name.
+func RegisterStrategy(name string, s Strategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	strategies[name] = s
+}
+
+// Strategies returns the sorted names of the registered strategies.
+func Strategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupStrategy(name string) (Strategy, error) {
+	if name == "" {
+		name = DefaultStrategy
+	}
+	strategiesMu.RLock()
+	s, ok := strategies[name]
+	strategiesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown promotion strategy %q, must be one of %s", name, strings.Join(Strategies(), ", "))
+	}
+	return s, nil
+}
+
+// lookupStrategy returns the strategy that the ServiceManager promotes
+// services with, the helm strategy promotes the keys configured with
+// WithHelmValues.
+func (s *ServiceManager) lookupStrategy() (Strategy, error) {
+	if s.strategy == helmStrategy && len(s.helmValues) > 0 {
+		return NewHelmStrategy(s.helmValues...), nil
+	}
+	return lookupStrategy(s.strategy)
+}
+
+// copyStrategy copies all the files for the service to the destination,
+// overwriting any existing files.
+func copyStrategy(serviceName string, source git.Source, destination git.Repo, sourceEnvironment, destinationEnvironment string) ([]string, error) {
+	if _, ok := source.(git.Repo); !ok {
+		return local.CopyConfig(serviceName, source, destination, destinationEnvironment)
+	}
+	return git.CopyService(serviceName, source, destination, sourceEnvironment, destinationEnvironment)
+}
+
+// mirrorStrategy copies all the files for the service to the destination, and
+// removes any files from the destination that are not in the source.
+func mirrorStrategy(serviceName string, source git.Source, destination git.Repo, sourceEnvironment, destinationEnvironment string) ([]string, error) {
+	copied, err := copyStrategy(serviceName, source, destination, sourceEnvironment, destinationEnvironment)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := git.PruneService(serviceName, destination, destinationEnvironment, copied)
+	if err != nil {
+		return nil, err
+	}
+	return append(copied, removed...), nil
+}
+
+// imageOnlyStrategy only updates the images used by the service in the
+// destination.
+func imageOnlyStrategy(serviceName string, source git.Source, destination git.Repo, sourceEnvironment, destinationEnvironment string) ([]string, error) {
+	if _, ok := source.(git.Repo); !ok {
+		return nil, errors.New("the image-only strategy is not supported from a local filesystem directory")
+	}
+	return git.CopyImages(serviceName, source, destination, sourceEnvironment, destinationEnvironment)
+}
+
+// NewHelmStrategy returns a strategy that promotes the version of the Helm
+// charts for a service, and the values for the keys (e.g. image.tag) in the
+// charts' values.yaml files.
+func NewHelmStrategy(keys ...string) Strategy {
+	return StrategyFunc(func(serviceName string, source git.Source, destination git.Repo, sourceEnvironment, destinationEnvironment string) ([]string, error) {
+		if _, ok := source.(git.Repo); !ok {
+			return nil, errors.New("the helm strategy is not supported from a local filesystem directory")
+		}
+		return git.CopyHelmValues(serviceName, source, destination, sourceEnvironment, destinationEnvironment, keys)
+	})
+}
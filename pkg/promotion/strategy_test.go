@@ -0,0 +1,124 @@
+package promotion
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/git/mock"
+	"github.com/rhd-gitops-example/services/pkg/logging"
+	"github.com/rhd-gitops-example/services/test"
+)
+
+func TestPromoteWithMirrorStrategy(t *testing.T) {
+	dstBranch := "test-branch"
+	author := &git.Author{Name: "Testing User", Email: "testing@example.com"}
+	devRepo, stagingRepo := mock.New("environments/dev", "master"), mock.New("environments/staging", "master")
+	repos := map[string]*mock.Repository{
+		dev.RepoPath:     devRepo,
+		staging.RepoPath: stagingRepo,
+	}
+	sm := New("tmp", author, WithStrategy("mirror"))
+	sm.clientFactory = func(s, ty, r string, v bool) *scm.Client {
+		client, _ := fakescm.NewDefault()
+		return client
+	}
+	sm.repoFactory = func(_ context.Context, url, _ string, _ bool, _ logging.Logger) (git.Repo, error) {
+		return git.Repo(repos[url]), nil
+	}
+	devRepo.AddFiles("services/my-service/base/config/myfile.yaml")
+	stagingRepo.AddFiles("services/my-service/base/config/oldfile.yaml")
+
+	err := sm.Promote(context.Background(), "my-service", dev, staging, dstBranch, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stagingRepo.AssertFileCopiedInBranch(t, dstBranch, "environments/dev/services/my-service/base/config/myfile.yaml", "environments/staging/services/my-service/base/config/myfile.yaml")
+	stagingRepo.AssertFileRemovedInBranch(t, dstBranch, "environments/staging/services/my-service/base/config/oldfile.yaml")
+	stagingRepo.AssertPush(t, dstBranch)
+}
+
+func TestPromoteWithUnknownStrategy(t *testing.T) {
+	author := &git.Author{Name: "Testing User", Email: "testing@example.com"}
+	stagingRepo := mock.New("environments/staging", "master")
+	sm := New("tmp", author, WithStrategy("unknown"))
+	sm.repoFactory = func(_ context.Context, url, _ string, _ bool, _ logging.Logger) (git.Repo, error) {
+		return git.Repo(stagingRepo), nil
+	}
+
+	err := sm.Promote(context.Background(), "my-service", dev, staging, "test-branch", "", false)
+	test.AssertErrorMatch(t, `unknown promotion strategy "unknown", must be one of copy, helm, image-only, mirror`, err)
+	stagingRepo.AssertNoCommits(t)
+}
+
+func TestRegisterStrategy(t *testing.T) {
+	var promoted string
+	RegisterStrategy("testing", StrategyFunc(func(serviceName string, source git.Source, destination git.Repo, sourceEnvironment, destinationEnvironment string) ([]string, error) {
+		promoted = serviceName
+		return []string{}, nil
+	}))
+	defer func() {
+		strategiesMu.Lock()
+		delete(strategies, "testing")
+		strategiesMu.Unlock()
+	}()
+
+	want := []string{"copy", "helm", "image-only", "mirror", "testing"}
+	if diff := cmp.Diff(want, Strategies()); diff != "" {
+		t.Fatalf("strategies did not match: %s", diff)
+	}
+	s, err := lookupStrategy("testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Promote("my-service", nil, nil, "dev", "staging"); err != nil {
+		t.Fatal(err)
+	}
+	if promoted != "my-service" {
+		t.Fatalf("registered strategy was not called, got %q", promoted)
+	}
+}
+
+func TestLookupStrategyWithHelmValues(t *testing.T) {
+	author := &git.Author{Name: "Testing User", Email: "testing@example.com"}
+	promote := func(sm *ServiceManager) error {
+		s, err := sm.lookupStrategy()
+		if err != nil {
+			return err
+		}
+		_, err = s.Promote("my-service", mock.New("environments/dev", "master"), mock.New("environments/staging", "master"), "dev", "staging")
+		return err
+	}
+
+	err := promote(New("tmp", author, WithStrategy("helm"), WithHelmValues([]string{"image[tag]"})))
+	test.AssertErrorMatch(t, `invalid values key "image\[tag\]"`, err)
+
+	// The keys configured for one ServiceManager aren't used by others.
+	err = promote(New("tmp", author, WithStrategy("helm")))
+	test.AssertErrorMatch(t, "no Helm charts found for service my-service", err)
+}
+
+func TestLookupStrategyUsesRegisteredHelmStrategy(t *testing.T) {
+	author := &git.Author{Name: "Testing User", Email: "testing@example.com"}
+	RegisterStrategy("helm", StrategyFunc(func(serviceName string, source git.Source, destination git.Repo, sourceEnvironment, destinationEnvironment string) ([]string, error) {
+		return nil, errors.New("custom helm strategy")
+	}))
+	defer RegisterStrategy("helm", NewHelmStrategy(git.DefaultHelmValues...))
+
+	for _, sm := range []*ServiceManager{
+		New("tmp", author, WithStrategy("helm")),
+		New("tmp", author, WithStrategy("helm"), WithHelmValues(nil)),
+	} {
+		s, err := sm.lookupStrategy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Promote("my-service", mock.New("environments/dev", "master"), mock.New("environments/staging", "master"), "dev", "staging")
+		test.AssertErrorMatch(t, "custom helm strategy", err)
+	}
+}
@@ -0,0 +1,197 @@
+package promotion
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationMode controls what happens when promoted files don't match the
+// schemas for the Kubernetes resources they contain.
+type ValidationMode string
+
+const (
+	// ValidateStrict aborts the promotion if any file fails validation.
+	ValidateStrict ValidationMode = "strict"
+	// ValidateWarn logs validation failures, but continues the promotion.
+	ValidateWarn ValidationMode = "warn"
+	// ValidateOff disables schema validation.
+	ValidateOff ValidationMode = "off"
+)
+
+// ParseValidationMode returns the ValidationMode for a string, or an error if
+// the mode is not known, validation is off if the string is empty.
+func ParseValidationMode(s string) (ValidationMode, error) {
+	switch m := ValidationMode(strings.ToLower(s)); m {
+	case ValidateStrict, ValidateWarn, ValidateOff:
+		return m, nil
+	case "":
+		return ValidateOff, nil
+	}
+	return "", fmt.Errorf("unknown validation mode %q, must be one of strict, warn or off", s)
+}
+
+// Validate checks that the repository at the location follows the GitOps
+// repository layout, and that all the configuration files in it can be parsed.
+//
+// The location can be a URL, in which case the branch is checked out to the
+// cache, or a local directory containing a GitOps repository.
+func (s *ServiceManager) Validate(ctx context.Context, location EnvLocation, keepCache bool) error {
+	s = s.withLogFields("repository", location.RepoPath)
+	isLocal, err := location.IsLocal()
+	if err != nil {
+		return fmt.Errorf("failed to determine if repository is local: %w", err)
+	}
+
+	var repo git.Repo
+	if isLocal {
+		repoPath, err := filepath.Abs(location.RepoPath)
+		if err != nil {
+			return fmt.Errorf("failed to determine the path to the repository: %w", err)
+		}
+		repo, err = s.repoFactory(ctx, repoPath, filepath.Dir(repoPath), s.tlsVerify, s.logger)
+		if err != nil {
+			return err
+		}
+	} else {
+		repo, err = s.checkoutSourceRepo(ctx, location.RepoPath, location.Branch)
+		if repo != nil {
+			defer s.clearCache(&[]git.Repo{repo}, keepCache)
+		}
+		if err != nil {
+			return git.WrapGitError(err, "error checking out repository from Git", location.RepoPath)
+		}
+		if err := checkoutRef(repo, location); err != nil {
+			return err
+		}
+	}
+
+	result, err := git.ValidateRepository(repo)
+	if err != nil {
+		return fmt.Errorf("failed to validate %v: %w", location, err)
+	}
+	for _, skipped := range result.Skipped {
+		s.logger.Info("file is not under base/config and will not be promoted", "file", skipped)
+	}
+	if err := result.Err(); err != nil {
+		return git.Errorf(ErrValidation, "%w", err)
+	}
+	return nil
+}
+
+// validateService is the pre-flight check for a promotion, the configuration
+// for the service in the source repository must exist and be parseable.
+func (s *ServiceManager) validateService(r git.Repo, serviceName, environmentName string) error {
+	result, err := git.ValidateService(r, serviceName, environmentName)
+	if err != nil {
+		return err
+	}
+	for _, skipped := range result.Skipped {
+		s.logger.Debug("file is not under base/config and will not be promoted", "file", skipped)
+	}
+	return result.Err()
+}
+
+// validateSchemas validates the Kubernetes resources in the promoted files
+// against their schemas, depending on the validation mode failures are either
+// logged or returned.
+//
+// Files that are kustomize patches only have the fields they change, so they
+// are validated with schema.Validator.ValidatePatch.
+func (s *ServiceManager) validateSchemas(r git.Repo, filenames []string) error {
+	if s.validationMode == "" || s.validationMode == ValidateOff {
+		return nil
+	}
+	v, err := schema.NewValidator(s.schemaDir)
+	if err != nil {
+		return err
+	}
+	patches, err := kustomizePatches(r, filenames)
+	if err != nil {
+		return err
+	}
+	result := &git.ValidationResult{}
+	for _, filename := range filenames {
+		ext := strings.ToLower(filepath.Ext(filename))
+		if ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		data, err := r.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s for validation: %w", filename, err)
+		}
+		validate := v.Validate
+		if patches[path.Clean(filename)] {
+			validate = v.ValidatePatch
+		}
+		errs, err := validate(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s for validation: %w", filename, err)
+		}
+		for _, e := range errs {
+			result.Problems = append(result.Problems, git.Problem{Path: filename, Message: e.Error()})
+		}
+	}
+	if err := result.Err(); err != nil {
+		if s.validationMode == ValidateWarn {
+			s.logger.Warn("promoted configuration failed schema validation", "error", err)
+			return nil
+		}
+		return git.Errorf(ErrValidation, "promoted configuration failed schema validation: %w", err)
+	}
+	return nil
+}
+
+// kustomizationFiles are the names that kustomize looks for in a directory.
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// kustomizePatches returns the paths of the patches listed in the
+// kustomization files in the directories of the files, or their parents, the
+// patches are listed in patchesStrategicMerge, or patches with a path.
+func kustomizePatches(r git.Repo, filenames []string) (map[string]bool, error) {
+	patches := map[string]bool{}
+	seen := map[string]bool{}
+	for _, filename := range filenames {
+		for dir := path.Dir(path.Clean(filename)); !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			for _, name := range kustomizationFiles {
+				kustomization := path.Join(dir, name)
+				data, err := r.ReadFile(kustomization)
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %s for validation: %w", kustomization, err)
+				}
+				var k struct {
+					PatchesStrategicMerge []string `yaml:"patchesStrategicMerge"`
+					Patches               []struct {
+						Path string `yaml:"path"`
+					} `yaml:"patches"`
+				}
+				if err := yaml.Unmarshal(data, &k); err != nil {
+					return nil, fmt.Errorf("failed to parse %s for validation: %w", kustomization, err)
+				}
+				for _, p := range k.PatchesStrategicMerge {
+					patches[path.Join(dir, p)] = true
+				}
+				for _, p := range k.Patches {
+					if p.Path != "" {
+						patches[path.Join(dir, p.Path)] = true
+					}
+				}
+			}
+		}
+	}
+	return patches, nil
+}
@@ -0,0 +1,72 @@
+package promotion
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rhd-gitops-example/services/pkg/git"
+	"github.com/rhd-gitops-example/services/pkg/git/mock"
+	"github.com/rhd-gitops-example/services/test"
+)
+
+func TestValidateSchemas(t *testing.T) {
+	invalid := "environments/staging/services/my-service/base/config/deployment.yaml"
+	repo := mock.New("", "master")
+	repo.AddFileContents(invalid, []byte("apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: two\n"))
+
+	validationTests := []struct {
+		mode    ValidationMode
+		wantErr string
+	}{
+		{ValidateStrict, "(?s)failed schema validation.*deployment.yaml: spec.replicas: expected integer, got string"},
+		{ValidateWarn, ""},
+		{ValidateOff, ""},
+		{"", ""},
+	}
+
+	for _, tt := range validationTests {
+		sm := New("tmp", &git.Author{}, WithSchemaValidation(tt.mode, ""))
+		err := sm.validateSchemas(repo, []string{invalid})
+		if !test.MatchErrorString(t, tt.wantErr, err) {
+			t.Errorf("validateSchemas() in mode %q got error %v, want %q", tt.mode, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateSchemasWithKustomizePatches(t *testing.T) {
+	base := "environments/staging/services/my-service/base"
+	repo := mock.New("", "master")
+	repo.AddFileContents(base+"/kustomization.yaml", []byte("resources:\n- config/deployment.yaml\npatchesStrategicMerge:\n- config/replicas.yaml\npatches:\n- path: config/resources.yaml\n  target:\n    kind: Deployment\n"))
+	repo.AddFileContents(base+"/config/deployment.yaml", []byte("apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 1\n"))
+	repo.AddFileContents(base+"/config/replicas.yaml", []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: my-service\nspec:\n  replicas: 3\n"))
+	repo.AddFileContents(base+"/config/resources.yaml", []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: my-service\nspec:\n  replicas: three\n"))
+	sm := New("tmp", &git.Author{}, WithSchemaValidation(ValidateStrict, ""))
+
+	err := sm.validateSchemas(repo, []string{base + "/config/deployment.yaml", base + "/config/replicas.yaml", base + "/config/resources.yaml"})
+	want := []string{
+		base + "/config/deployment.yaml: spec.selector: required field is missing",
+		base + "/config/deployment.yaml: spec.template: required field is missing",
+		base + "/config/resources.yaml: spec.replicas: expected integer, got string",
+	}
+	for _, w := range want {
+		if err == nil || !strings.Contains(err.Error(), w) {
+			t.Errorf("got error %v, want it to contain %q", err, w)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "replicas.yaml") {
+		t.Errorf("got error %v, want the patch replicas.yaml to be valid", err)
+	}
+}
+
+func TestParseValidationMode(t *testing.T) {
+	for _, s := range []string{"strict", "warn", "off", "Strict"} {
+		if _, err := ParseValidationMode(s); err != nil {
+			t.Errorf("ParseValidationMode(%q) failed: %s", s, err)
+		}
+	}
+	if m, err := ParseValidationMode(""); m != ValidateOff || err != nil {
+		t.Errorf("ParseValidationMode(\"\") got %q (%v), want %q", m, err, ValidateOff)
+	}
+	_, err := ParseValidationMode("sometimes")
+	test.AssertErrorMatch(t, "unknown validation mode", err)
+}
@@ -0,0 +1,65 @@
+// Package retry retries operations that fail with transient errors, e.g. a
+// Git server that's unavailable, waiting longer after each failed attempt.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Policy configures how many times an operation is attempted, and how long to
+// wait between the attempts.
+//
+// The delay before the first retry is InitialDelay, and it's doubled for each
+// later retry, up to MaxDelay. The delays are randomised by the Jitter, so that
+// promotions that failed at the same time don't retry at the same time.
+type Policy struct {
+	// Attempts is the maximum number of times the operation is attempted,
+	// including the first, it's attempted once if this is less than 2.
+	Attempts int
+	// InitialDelay is how long to wait before the first retry.
+	InitialDelay time.Duration
+	// MaxDelay is the longest to wait before a retry, the delay isn't limited
+	// if it's not set.
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay that's randomised, e.g. with a
+	// Jitter of 0.2, a 10s delay is between 8s and 12s.
+	Jitter float64
+}
+
+// DefaultPolicy retries an operation up to three times, after 1s, 2s and 4s.
+var DefaultPolicy = Policy{Attempts: 4, InitialDelay: time.Second, MaxDelay: 30 * time.Second, Jitter: 0.2}
+
+// Do calls op until it succeeds, or it fails with an error that retryable
+// reports isn't transient, or the attempts are used up, and returns the error
+// from the last attempt.
+//
+// retryable is only called when there are attempts left, and the waits between
+// the attempts are stopped if the context is cancelled.
+func (p Policy) Do(ctx context.Context, retryable func(error) bool, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= p.Attempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(p.delay(attempt, rand.Float64())):
+		}
+	}
+}
+
+// delay returns how long to wait after the failed attempt, r is a random
+// number in [0, 1) that's used to apply the jitter.
+func (p Policy) delay(attempt int, r float64) time.Duration {
+	d := p.InitialDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return time.Duration(float64(d) * (1 + p.Jitter*(2*r-1)))
+}
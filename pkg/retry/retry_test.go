@@ -0,0 +1,97 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient failure")
+
+func isTransient(err error) bool {
+	return err == errTransient
+}
+
+func TestDoRetriesTransientErrors(t *testing.T) {
+	calls := 0
+	err := Policy{Attempts: 3}.Do(context.Background(), isTransient, func() error {
+		calls++
+		if calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+
+	if err != nil || calls != 3 {
+		t.Fatalf("got %v after %d calls, want success after 3", err, calls)
+	}
+}
+
+func TestDoStopsAfterAttempts(t *testing.T) {
+	calls := 0
+	err := Policy{Attempts: 3}.Do(context.Background(), isTransient, func() error {
+		calls++
+		return errTransient
+	})
+
+	if err != errTransient || calls != 3 {
+		t.Fatalf("got %v after %d calls, want %v after 3", err, calls, errTransient)
+	}
+}
+
+func TestDoDoesNotRetryOtherErrors(t *testing.T) {
+	failed := errors.New("failed")
+	calls := 0
+	err := DefaultPolicy.Do(context.Background(), isTransient, func() error {
+		calls++
+		return failed
+	})
+
+	if err != failed || calls != 1 {
+		t.Fatalf("got %v after %d calls, want %v after 1", err, calls, failed)
+	}
+}
+
+func TestDoStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	start := time.Now()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	err := Policy{Attempts: 3, InitialDelay: time.Minute}.Do(ctx, isTransient, func() error {
+		calls++
+		return errTransient
+	})
+
+	if err != errTransient || calls != 1 {
+		t.Fatalf("got %v after %d calls, want %v after 1", err, calls, errTransient)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("took %s to stop after the context was cancelled", elapsed)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	p := Policy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Jitter: 0.2}
+	delayTests := []struct {
+		attempt int
+		r       float64
+		want    time.Duration
+	}{
+		{1, 0.5, time.Second},
+		{2, 0.5, 2 * time.Second},
+		{3, 0.5, 4 * time.Second},
+		{4, 0.5, 5 * time.Second},
+		{100, 0.5, 5 * time.Second},
+		{1, 0, 800 * time.Millisecond},
+		{3, 1, 4800 * time.Millisecond},
+	}
+	for _, tt := range delayTests {
+		if got := p.delay(tt.attempt, tt.r); got != tt.want {
+			t.Errorf("delay(%d, %v) got %s, want %s", tt.attempt, tt.r, got, tt.want)
+		}
+	}
+}
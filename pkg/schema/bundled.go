@@ -0,0 +1,349 @@
+package schema
+
+// bundledSchemas are the schemas for the built-in Kubernetes (and OpenShift)
+// resources that are most commonly found in a GitOps repository.
+//
+// These are a subset of the Kubernetes OpenAPI schemas, they describe the
+// fields that are most often got wrong, and are kept in source so that
+// validation works offline.
+const bundledSchemas = `
+definitions:
+  ObjectMeta:
+    type: object
+    properties:
+      name: {type: string}
+      namespace: {type: string}
+      generateName: {type: string}
+      labels: {type: object, additionalProperties: {type: string}}
+      annotations: {type: object, additionalProperties: {type: string}}
+  LabelSelector:
+    type: object
+    properties:
+      matchLabels: {type: object, additionalProperties: {type: string}}
+      matchExpressions:
+        type: array
+        items:
+          type: object
+          required: [key, operator]
+          properties:
+            key: {type: string}
+            operator: {type: string}
+            values: {type: array, items: {type: string}}
+  ResourceRequirements:
+    type: object
+    properties:
+      limits: {type: object, additionalProperties: {$ref: "#/definitions/Quantity"}}
+      requests: {type: object, additionalProperties: {$ref: "#/definitions/Quantity"}}
+  Quantity:
+    x-kubernetes-int-or-string: true
+    format: quantity
+  EnvVar:
+    type: object
+    required: [name]
+    properties:
+      name: {type: string}
+      value: {type: string}
+      valueFrom: {type: object}
+  Probe:
+    type: object
+    properties:
+      initialDelaySeconds: {type: integer}
+      timeoutSeconds: {type: integer}
+      periodSeconds: {type: integer}
+      successThreshold: {type: integer}
+      failureThreshold: {type: integer}
+      httpGet:
+        type: object
+        required: [port]
+        properties:
+          path: {type: string}
+          port: {x-kubernetes-int-or-string: true}
+          scheme: {type: string}
+      tcpSocket:
+        type: object
+        required: [port]
+        properties:
+          port: {x-kubernetes-int-or-string: true}
+      exec:
+        type: object
+        properties:
+          command: {type: array, items: {type: string}}
+  Container:
+    type: object
+    required: [name]
+    properties:
+      name: {type: string}
+      image: {type: string}
+      imagePullPolicy: {type: string, enum: [Always, Never, IfNotPresent]}
+      command: {type: array, items: {type: string}}
+      args: {type: array, items: {type: string}}
+      workingDir: {type: string}
+      ports:
+        type: array
+        items:
+          type: object
+          required: [containerPort]
+          properties:
+            name: {type: string}
+            containerPort: {type: integer}
+            hostPort: {type: integer}
+            protocol: {type: string, enum: [TCP, UDP, SCTP]}
+      env: {type: array, items: {$ref: "#/definitions/EnvVar"}}
+      envFrom: {type: array, items: {type: object}}
+      resources: {$ref: "#/definitions/ResourceRequirements"}
+      volumeMounts:
+        type: array
+        items:
+          type: object
+          required: [name, mountPath]
+          properties:
+            name: {type: string}
+            mountPath: {type: string}
+            subPath: {type: string}
+            readOnly: {type: boolean}
+      livenessProbe: {$ref: "#/definitions/Probe"}
+      readinessProbe: {$ref: "#/definitions/Probe"}
+      startupProbe: {$ref: "#/definitions/Probe"}
+  PodSpec:
+    type: object
+    required: [containers]
+    properties:
+      containers: {type: array, items: {$ref: "#/definitions/Container"}}
+      initContainers: {type: array, items: {$ref: "#/definitions/Container"}}
+      serviceAccountName: {type: string}
+      restartPolicy: {type: string, enum: [Always, OnFailure, Never]}
+      nodeSelector: {type: object, additionalProperties: {type: string}}
+      terminationGracePeriodSeconds: {type: integer}
+      volumes:
+        type: array
+        items:
+          type: object
+          required: [name]
+          properties:
+            name: {type: string}
+      imagePullSecrets:
+        type: array
+        items:
+          type: object
+          properties:
+            name: {type: string}
+  PodTemplateSpec:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec: {$ref: "#/definitions/PodSpec"}
+  JobSpec:
+    type: object
+    required: [template]
+    properties:
+      parallelism: {type: integer}
+      completions: {type: integer}
+      backoffLimit: {type: integer}
+      activeDeadlineSeconds: {type: integer}
+      template: {$ref: "#/definitions/PodTemplateSpec"}
+
+kinds:
+- group: ""
+  version: v1
+  kind: Pod
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec: {$ref: "#/definitions/PodSpec"}
+- group: ""
+  version: v1
+  kind: Service
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec:
+        type: object
+        properties:
+          type: {type: string, enum: [ClusterIP, NodePort, LoadBalancer, ExternalName]}
+          selector: {type: object, additionalProperties: {type: string}}
+          clusterIP: {type: string}
+          externalName: {type: string}
+          ports:
+            type: array
+            items:
+              type: object
+              required: [port]
+              properties:
+                name: {type: string}
+                port: {type: integer}
+                targetPort: {x-kubernetes-int-or-string: true}
+                nodePort: {type: integer}
+                protocol: {type: string, enum: [TCP, UDP, SCTP]}
+- group: ""
+  version: v1
+  kind: ConfigMap
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      data: {type: object, additionalProperties: {type: string}}
+      binaryData: {type: object, additionalProperties: {type: string}}
+- group: ""
+  version: v1
+  kind: Secret
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      type: {type: string}
+      data: {type: object, additionalProperties: {type: string}}
+      stringData: {type: object, additionalProperties: {type: string}}
+- group: ""
+  version: v1
+  kind: ServiceAccount
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+- group: ""
+  version: v1
+  kind: Namespace
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+- group: apps
+  version: v1
+  kind: Deployment
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec:
+        type: object
+        required: [selector, template]
+        properties:
+          replicas: {type: integer}
+          selector: {$ref: "#/definitions/LabelSelector"}
+          template: {$ref: "#/definitions/PodTemplateSpec"}
+          minReadySeconds: {type: integer}
+          revisionHistoryLimit: {type: integer}
+          paused: {type: boolean}
+          strategy:
+            type: object
+            properties:
+              type: {type: string, enum: [Recreate, RollingUpdate]}
+- group: apps
+  version: v1
+  kind: StatefulSet
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec:
+        type: object
+        required: [selector, template]
+        properties:
+          replicas: {type: integer}
+          serviceName: {type: string}
+          selector: {$ref: "#/definitions/LabelSelector"}
+          template: {$ref: "#/definitions/PodTemplateSpec"}
+- group: apps
+  version: v1
+  kind: DaemonSet
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec:
+        type: object
+        required: [selector, template]
+        properties:
+          selector: {$ref: "#/definitions/LabelSelector"}
+          template: {$ref: "#/definitions/PodTemplateSpec"}
+- group: batch
+  version: v1
+  kind: Job
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec: {$ref: "#/definitions/JobSpec"}
+- group: batch
+  version: v1
+  kind: CronJob
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec:
+        type: object
+        required: [schedule, jobTemplate]
+        properties:
+          schedule: {type: string}
+          suspend: {type: boolean}
+          concurrencyPolicy: {type: string, enum: [Allow, Forbid, Replace]}
+          jobTemplate:
+            type: object
+            properties:
+              metadata: {$ref: "#/definitions/ObjectMeta"}
+              spec: {$ref: "#/definitions/JobSpec"}
+- group: networking.k8s.io
+  version: v1
+  kind: Ingress
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec:
+        type: object
+        properties:
+          ingressClassName: {type: string}
+          rules:
+            type: array
+            items:
+              type: object
+              properties:
+                host: {type: string}
+                http:
+                  type: object
+                  required: [paths]
+                  properties:
+                    paths:
+                      type: array
+                      items:
+                        type: object
+                        required: [backend]
+                        properties:
+                          path: {type: string}
+                          pathType: {type: string, enum: [Exact, Prefix, ImplementationSpecific]}
+                          backend: {type: object}
+          tls:
+            type: array
+            items:
+              type: object
+              properties:
+                hosts: {type: array, items: {type: string}}
+                secretName: {type: string}
+- group: route.openshift.io
+  version: v1
+  kind: Route
+  schema:
+    type: object
+    properties:
+      metadata: {$ref: "#/definitions/ObjectMeta"}
+      spec:
+        type: object
+        required: [to]
+        properties:
+          host: {type: string}
+          path: {type: string}
+          to:
+            type: object
+            required: [name]
+            properties:
+              kind: {type: string}
+              name: {type: string}
+              weight: {type: integer}
+          port:
+            type: object
+            properties:
+              targetPort: {x-kubernetes-int-or-string: true}
+`
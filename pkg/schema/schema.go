@@ -0,0 +1,218 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is the subset of an OpenAPI v3 schema that is used to validate
+// Kubernetes resources.
+//
+// Fields that are not described in a schema are not reported, the bundled
+// schemas only describe the most commonly used fields of each resource.
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Required             []string           `yaml:"required"`
+	Items                *Schema            `yaml:"items"`
+	AdditionalProperties *Schema            `yaml:"-"`
+	Enum                 []interface{}      `yaml:"enum"`
+	AnyOf                []*Schema          `yaml:"anyOf"`
+	OneOf                []*Schema          `yaml:"oneOf"`
+	IntOrString          bool               `yaml:"x-kubernetes-int-or-string"`
+	PreserveUnknown      bool               `yaml:"x-kubernetes-preserve-unknown-fields"`
+}
+
+// UnmarshalYAML handles additionalProperties being either a boolean or a
+// schema, only the schema form is used for validation.
+func (s *Schema) UnmarshalYAML(n *yaml.Node) error {
+	type plain Schema
+	if err := n.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == "additionalProperties" && n.Content[i+1].Kind == yaml.MappingNode {
+			s.AdditionalProperties = &Schema{}
+			return n.Content[i+1].Decode(s.AdditionalProperties)
+		}
+	}
+	return nil
+}
+
+// FieldError is a single way in which a document doesn't match its schema.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// validate checks the value against the schema, appending any errors, refs
+// are resolved from the definitions.
+//
+// If partial is true, the value only has some of the fields, e.g. it's a
+// patch, and missing required fields are not reported.
+func (s *Schema) validate(definitions map[string]*Schema, partial bool, field string, v interface{}, errs []FieldError) []FieldError {
+	if s == nil || v == nil {
+		return errs
+	}
+	if s.Ref != "" {
+		ref, ok := definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+		if !ok {
+			return append(errs, FieldError{Field: field, Message: fmt.Sprintf("unknown schema reference %s", s.Ref)})
+		}
+		return ref.validate(definitions, partial, field, v, errs)
+	}
+	if len(s.AnyOf) > 0 && !matchesAny(definitions, partial, field, v, s.AnyOf) {
+		errs = append(errs, FieldError{Field: field, Message: "does not match any of the allowed schemas"})
+	}
+	if len(s.OneOf) > 0 && !matchesAny(definitions, partial, field, v, s.OneOf) {
+		errs = append(errs, FieldError{Field: field, Message: "does not match any of the allowed schemas"})
+	}
+	if s.Format == "quantity" {
+		if !isInteger(v) && !isFloat(v) && !isString(v) {
+			errs = append(errs, typeError(field, "number or string", v))
+		}
+		return errs
+	}
+	if s.IntOrString {
+		if !isInteger(v) && !isString(v) {
+			errs = append(errs, typeError(field, "integer or string", v))
+		}
+		return errs
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("unsupported value %v, must be one of %v", v, s.Enum)})
+	}
+
+	switch s.Type {
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return append(errs, typeError(field, "object", v))
+		}
+		for _, r := range s.Required {
+			if _, ok := m[r]; !ok && !partial {
+				errs = append(errs, FieldError{Field: join(field, r), Message: "required field is missing"})
+			}
+		}
+		for _, k := range sortedKeys(m) {
+			if p, ok := s.Properties[k]; ok {
+				errs = p.validate(definitions, partial, join(field, k), m[k], errs)
+			} else if s.AdditionalProperties != nil {
+				errs = s.AdditionalProperties.validate(definitions, partial, join(field, k), m[k], errs)
+			}
+		}
+	case "array":
+		a, ok := v.([]interface{})
+		if !ok {
+			return append(errs, typeError(field, "array", v))
+		}
+		for i, item := range a {
+			errs = s.Items.validate(definitions, partial, fmt.Sprintf("%s[%d]", field, i), item, errs)
+		}
+	case "string":
+		if !isString(v) {
+			errs = append(errs, typeError(field, "string", v))
+		}
+	case "integer":
+		if !isInteger(v) {
+			errs = append(errs, typeError(field, "integer", v))
+		}
+	case "number":
+		if !isInteger(v) && !isFloat(v) {
+			errs = append(errs, typeError(field, "number", v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, typeError(field, "boolean", v))
+		}
+	}
+	return errs
+}
+
+func matchesAny(definitions map[string]*Schema, partial bool, field string, v interface{}, schemas []*Schema) bool {
+	for _, s := range schemas {
+		if len(s.validate(definitions, partial, field, v, nil)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func typeError(field, want string, v interface{}) FieldError {
+	return FieldError{Field: field, Message: fmt.Sprintf("expected %s, got %s", want, typeName(v))}
+}
+
+func typeName(v interface{}) string {
+	switch {
+	case isString(v):
+		return "string"
+	case isInteger(v):
+		return "integer"
+	case isFloat(v):
+		return "number"
+	}
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func isString(v interface{}) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+func isInteger(v interface{}) bool {
+	switch v.(type) {
+	case int, int64, uint64:
+		return true
+	}
+	return false
+}
+
+func isFloat(v interface{}) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+func inEnum(v interface{}, enum []interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,190 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validator validates Kubernetes resources against the bundled schemas, and
+// the schemas from any CustomResourceDefinitions that were loaded.
+//
+// Resources with an apiVersion and kind that there is no schema for are not
+// validated.
+type Validator struct {
+	definitions map[string]*Schema
+	kinds       map[string]*Schema
+}
+
+type bundle struct {
+	Definitions map[string]*Schema `yaml:"definitions"`
+	Kinds       []struct {
+		Group   string  `yaml:"group"`
+		Version string  `yaml:"version"`
+		Kind    string  `yaml:"kind"`
+		Schema  *Schema `yaml:"schema"`
+	} `yaml:"kinds"`
+}
+
+// NewValidator creates and returns a Validator with the bundled schemas.
+//
+// If crdDir is not empty, the schemas from the CustomResourceDefinitions in the
+// YAML files in that directory are also loaded.
+func NewValidator(crdDir string) (*Validator, error) {
+	var b bundle
+	if err := yaml.Unmarshal([]byte(bundledSchemas), &b); err != nil {
+		return nil, fmt.Errorf("failed to load the bundled schemas: %w", err)
+	}
+	v := &Validator{definitions: b.Definitions, kinds: map[string]*Schema{}}
+	for _, k := range b.Kinds {
+		v.kinds[key(k.Group, k.Version, k.Kind)] = k.Schema
+	}
+	if crdDir != "" {
+		if err := v.loadCRDs(crdDir); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Validate validates each of the resources in a (possibly multi-document) YAML
+// file, and returns the errors found.
+//
+// Documents that don't have both an apiVersion and a kind, for example
+// kustomization.yaml files, are not validated.
+func (v *Validator) Validate(data []byte) ([]FieldError, error) {
+	return v.validate(data, false)
+}
+
+// ValidatePatch validates each of the resources in a YAML file of kustomize
+// patches, and returns the errors found.
+//
+// A strategic merge patch only has the fields that it changes, so the types of
+// the fields are validated, but missing required fields are not reported.
+func (v *Validator) ValidatePatch(data []byte) ([]FieldError, error) {
+	return v.validate(data, true)
+}
+
+func (v *Validator) validate(data []byte, partial bool) ([]FieldError, error) {
+	errs := []FieldError{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 0; ; i++ {
+		var doc interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return errs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		resource, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		apiVersion, _ := resource["apiVersion"].(string)
+		kind, _ := resource["kind"].(string)
+		if apiVersion == "" || kind == "" {
+			continue
+		}
+		group, version := groupVersion(apiVersion)
+		s, ok := v.kinds[key(group, version, kind)]
+		if !ok {
+			continue
+		}
+		field := ""
+		if i > 0 {
+			field = fmt.Sprintf("document %d", i+1)
+		}
+		for _, e := range s.validate(v.definitions, partial, "", resource, nil) {
+			if field != "" {
+				e.Field = field + ": " + e.Field
+			}
+			errs = append(errs, e)
+		}
+	}
+}
+
+type crd struct {
+	Kind string `yaml:"kind"`
+	Spec struct {
+		Group string `yaml:"group"`
+		Names struct {
+			Kind string `yaml:"kind"`
+		} `yaml:"names"`
+		Version    string `yaml:"version"`
+		Validation struct {
+			OpenAPIV3Schema *Schema `yaml:"openAPIV3Schema"`
+		} `yaml:"validation"`
+		Versions []struct {
+			Name   string `yaml:"name"`
+			Schema struct {
+				OpenAPIV3Schema *Schema `yaml:"openAPIV3Schema"`
+			} `yaml:"schema"`
+		} `yaml:"versions"`
+	} `yaml:"spec"`
+}
+
+// loadCRDs reads the schemas for each version of the
+// CustomResourceDefinitions found in the directory, both the v1 and v1beta1
+// forms are supported.
+func (v *Validator) loadCRDs(dir string) error {
+	return filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to read schemas from %s: %w", dir, err)
+		}
+		ext := strings.ToLower(filepath.Ext(filename))
+		if info.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			return nil
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file %s: %w", filename, err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var c crd
+			err := dec.Decode(&c)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to parse schema file %s: %w", filename, err)
+			}
+			if c.Kind != "CustomResourceDefinition" {
+				continue
+			}
+			for _, ver := range c.Spec.Versions {
+				s := ver.Schema.OpenAPIV3Schema
+				if s == nil {
+					s = c.Spec.Validation.OpenAPIV3Schema
+				}
+				if s != nil {
+					v.kinds[key(c.Spec.Group, ver.Name, c.Spec.Names.Kind)] = s
+				}
+			}
+			if c.Spec.Version != "" && c.Spec.Validation.OpenAPIV3Schema != nil {
+				v.kinds[key(c.Spec.Group, c.Spec.Version, c.Spec.Names.Kind)] = c.Spec.Validation.OpenAPIV3Schema
+			}
+		}
+	})
+}
+
+// groupVersion returns the group and version from an apiVersion, the core
+// group is represented by an empty string.
+func groupVersion(apiVersion string) (string, string) {
+	parts := strings.SplitN(apiVersion, "/", 2)
+	if len(parts) == 1 {
+		return "", parts[0]
+	}
+	return parts[0], parts[1]
+}
+
+func key(group, version, kind string) string {
+	return group + "/" + version + "/" + kind
+}
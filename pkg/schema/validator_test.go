@@ -0,0 +1,229 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const validDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: service-a
+  labels:
+    app: service-a
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: service-a
+  template:
+    metadata:
+      labels:
+        app: service-a
+    spec:
+      containers:
+      - name: service-a
+        image: quay.io/example/service-a:v1
+        ports:
+        - containerPort: 8080
+        resources:
+          limits:
+            cpu: 500m
+            memory: 128Mi
+`
+
+func TestValidate(t *testing.T) {
+	validateTests := []struct {
+		name     string
+		resource string
+		want     []string
+	}{
+		{"valid deployment", validDeployment, []string{}},
+		{"kustomization is not validated", "resources:\n- deployment.yaml\n", []string{}},
+		{"unknown kinds are not validated", "apiVersion: example.com/v1\nkind: Widget\nspec: 1\n", []string{}},
+		{
+			"wrong types",
+			`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: service-a
+spec:
+  replicas: "two"
+  selector: {}
+  template:
+    spec:
+      containers:
+      - name: service-a
+        ports:
+        - containerPort: http
+`,
+			[]string{
+				"spec.replicas: expected integer, got string",
+				"spec.template.spec.containers[0].ports[0].containerPort: expected integer, got string",
+			},
+		},
+		{
+			"quantities can be numbers or strings",
+			`apiVersion: v1
+kind: Pod
+metadata:
+  name: service-a
+spec:
+  containers:
+  - name: service-a
+    resources:
+      limits:
+        cpu: 0.5
+        memory: 1.5Gi
+      requests:
+        cpu: 1
+        memory: [128Mi]
+`,
+			[]string{"spec.containers[0].resources.requests.memory: expected number or string, got array"},
+		},
+		{
+			"missing required fields",
+			"apiVersion: v1\nkind: Service\nspec:\n  ports:\n  - targetPort: 8080\n",
+			[]string{"spec.ports[0].port: required field is missing"},
+		},
+		{
+			"second document is reported",
+			"apiVersion: v1\nkind: ConfigMap\ndata:\n  key: value\n---\napiVersion: v1\nkind: ConfigMap\ndata:\n  key: [value]\n",
+			[]string{"document 2: data.key: expected string, got array"},
+		},
+		{
+			"enum values",
+			"apiVersion: v1\nkind: Service\nspec:\n  type: Internal\n",
+			[]string{"spec.type: unsupported value Internal, must be one of [ClusterIP NodePort LoadBalancer ExternalName]"},
+		},
+	}
+
+	v, err := NewValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range validateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := v.Validate([]byte(tt.resource))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, errorStrings(errs)); diff != "" {
+				t.Fatalf("validation errors did not match: %s", diff)
+			}
+		})
+	}
+}
+
+func TestValidatePatch(t *testing.T) {
+	const patch = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: service-a
+spec:
+  replicas: 3
+`
+	v, err := NewValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, err := v.Validate([]byte(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"spec.selector: required field is missing", "spec.template: required field is missing"}
+	if diff := cmp.Diff(want, errorStrings(errs)); diff != "" {
+		t.Fatalf("validation errors did not match: %s", diff)
+	}
+
+	errs, err = v.ValidatePatch([]byte(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{}, errorStrings(errs)); diff != "" {
+		t.Fatalf("patch validation errors did not match: %s", diff)
+	}
+
+	errs, err = v.ValidatePatch([]byte("apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: three\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"spec.replicas: expected integer, got string"}, errorStrings(errs)); diff != "" {
+		t.Fatalf("patch validation errors did not match: %s", diff)
+	}
+}
+
+func TestValidateWithCustomResourceDefinitions(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	crd := `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required: [size]
+            properties:
+              size: {type: integer}
+              labels:
+                type: object
+                additionalProperties: {type: string}
+            additionalProperties: false
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "widget.yaml"), []byte(crd), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewValidator(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, err := v.Validate([]byte("apiVersion: example.com/v1\nkind: Widget\nspec:\n  labels:\n    tier: 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"spec.size: required field is missing",
+		"spec.labels.tier: expected string, got integer",
+	}
+	if diff := cmp.Diff(want, errorStrings(errs)); diff != "" {
+		t.Fatalf("validation errors did not match: %s", diff)
+	}
+}
+
+func TestValidateWithInvalidYAML(t *testing.T) {
+	v, err := NewValidator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.Validate([]byte("kind: [Deployment\n"))
+	if err == nil {
+		t.Fatal("expected an error parsing invalid YAML")
+	}
+}
+
+func errorStrings(errs []FieldError) []string {
+	s := []string{}
+	for _, e := range errs {
+		s = append(s, e.Error())
+	}
+	return s
+}